@@ -0,0 +1,403 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/telegram"
+)
+
+// BotOptions configure moderation via Telegram: pending posts are sent to
+// AdminChat and can be decided upon by the users in AdminUserIDs, who can
+// also submit new posts by sending links to the bot in a private chat.
+type BotOptions struct {
+	AdminChat    telegram.Chat
+	AdminUserIDs []int64
+
+	// SaveToPinboard makes links submitted to the bot get bookmarked
+	// on Pinboard as well, so that it stays the source of truth.
+	SaveToPinboard bool
+}
+
+func (opt BotOptions) IsAdmin(userID int64) bool {
+	for _, id := range opt.AdminUserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	callbackPublish    = "publish"
+	callbackConfirm    = "confirm"
+	callbackAddHN      = "addhn"
+	callbackFinalURLs  = "finalurls"
+	callbackLater      = "later"
+	callbackSkip       = "skip"
+	callbackCategories = "categories"
+	callbackBack       = "back"
+	callbackCategory   = "cat:"
+)
+
+// pollRetryDelay is the delay before polling again after a failure,
+// doubled on each next one up to maxPollRetryDelay.
+const (
+	pollRetryDelay    = time.Second
+	maxPollRetryDelay = time.Minute
+)
+
+type moderationBot struct {
+	env    *Env
+	client *telegram.Client
+	// previews are the undecided posts keyed by preview message ID
+	previews map[int]*pendingPost
+
+	sleep func(time.Duration)
+}
+
+// RunBot sends every pending post to the admin chat, then keeps handling
+// the moderators' decisions and link submissions until interrupted.
+func RunBot(conf Configuration) error {
+	env, err := newEnv(conf)
+	if err != nil {
+		return err
+	}
+
+	// moderation happens in the admin chat even in dry mode
+	client := *env.Telegram
+	client.DryMode = false
+
+	bot := &moderationBot{
+		env:      env,
+		client:   &client,
+		previews: make(map[int]*pendingPost),
+	}
+
+	cands, err := loadCandidates(env.Sources)
+	if err != nil {
+		return err
+	}
+	for _, c := range cands {
+		pending, err := env.prepare(c)
+		if err != nil {
+			return fmt.Errorf("%v [while handling: %s]", err, c.TitleOrURL())
+		}
+		if pending == nil {
+			continue
+		}
+		if err := bot.sendPreview(pending); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Waiting for decisions on %d posts in %v and for submissions...", len(bot.previews), conf.Bot.AdminChat)
+	bot.loop()
+	return nil
+}
+
+// loop polls for updates forever; a failed poll is retried after a delay,
+// so that a network outage doesn't stop the bot.
+func (bot *moderationBot) loop() {
+	offset := 0
+	var delay time.Duration
+	for {
+		updates, err := bot.client.GetUpdates(offset, telegram.PollTimeout)
+		if err != nil {
+			if delay == 0 {
+				delay = pollRetryDelay
+			} else if delay *= 2; delay > maxPollRetryDelay {
+				delay = maxPollRetryDelay
+			}
+			log.Printf("[bot] WARNING: cannot get updates, retrying in %v: %v", delay, err)
+			bot.doSleep(delay)
+			continue
+		}
+		delay = 0
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			if err := bot.handleUpdate(u); err != nil {
+				log.Printf("[bot] WARNING: %v", err)
+			}
+		}
+	}
+}
+
+func (bot *moderationBot) handleUpdate(u *telegram.Update) error {
+	if u.CallbackQuery != nil {
+		return bot.handleCallback(u.CallbackQuery)
+	} else if u.Message != nil && u.Message.Chat.Type == "private" {
+		return bot.handleSubmission(u.Message)
+	}
+	return nil
+}
+
+func (bot *moderationBot) doSleep(d time.Duration) {
+	if bot.sleep != nil {
+		bot.sleep(d)
+	} else {
+		time.Sleep(d)
+	}
+}
+
+func (bot *moderationBot) sendPreview(pending *pendingPost) error {
+	id, err := bot.client.Send(bot.env.Conf.Bot.AdminChat, bot.preview(pending, "", bot.decisionButtons(pending)))
+	if err != nil {
+		return err
+	}
+	bot.previews[id] = pending
+	return nil
+}
+
+func (bot *moderationBot) handleSubmission(m *telegram.IncomingMessage) error {
+	env := bot.env
+	if m.From == nil || !env.Conf.Bot.IsAdmin(m.From.ID) {
+		log.Printf("[bot] ignoring message from non-admin user %v", m.From)
+		return bot.reply(m, "Sorry, only admins can submit links.")
+	}
+
+	sub, err := parseSubmission(m.Text, env.Conf.Content.MarkerTag, time.Now())
+	if err != nil {
+		return bot.reply(m, "Cannot add this: "+err.Error()+". Send a link, optionally followed by a comment, #hashtags and trailing links like HN.")
+	}
+
+	if env.State.LookupSubmission(sub.URL) != nil {
+		return bot.reply(m, "This link has already been submitted.")
+	}
+	if as := env.State.PublishedArticles[HashOfURL(sub.URL)]; as != nil && (as.Skip || len(as.Channels) > 0) {
+		return bot.reply(m, "This link has already been published or skipped.")
+	}
+
+	c := sub.Candidate()
+	post, err := parsePost(c, env.Conf.Content)
+	if err == nil {
+		err = checkTopics(post.Options, env.Conf.Destinations)
+	}
+	if err == nil {
+		err = checkImage(post.Image, env.Conf.Content.ImageDir)
+	}
+	if err != nil {
+		return bot.reply(m, "Cannot add this: "+err.Error()+".")
+	}
+	if post.Category == nil {
+		return bot.reply(m, "Cannot add this: add a category hashtag.")
+	}
+
+	// nothing is saved until the post is known to be publishable, so that
+	// a corrected resubmission isn't refused as a duplicate
+	pending, err := env.prepare(c)
+	if err != nil {
+		return bot.reply(m, "Cannot add this: "+err.Error()+".")
+	}
+	if pending == nil {
+		return bot.reply(m, "Cannot add this: no destination accepts "+post.Category.Title+".")
+	}
+
+	if env.Conf.Bot.SaveToPinboard {
+		if err := env.Pinboard.Add(c.PinboardPost(), false); err != nil {
+			log.Printf("[bot] WARNING: cannot save submission to Pinboard: %v", err)
+			return bot.reply(m, "Cannot save to Pinboard: "+err.Error())
+		}
+	}
+
+	env.State.Submissions = append(env.State.Submissions, sub)
+	if err := env.saveState(); err != nil {
+		return err
+	}
+	log.Printf("[bot] %v submitted %s", m.From, sub.URL)
+
+	if err := bot.sendPreview(pending); err != nil {
+		return err
+	}
+	return bot.reply(m, "Added, see the preview in the admin chat.")
+}
+
+func (bot *moderationBot) reply(m *telegram.IncomingMessage, text string) error {
+	_, err := bot.client.Send(m.Chat.Chat(), &telegram.Message{
+		MarkdownText:     telegram.Escape(text),
+		ReplyToMessageID: m.MessageID,
+	})
+	return err
+}
+
+func (bot *moderationBot) handleCallback(q *telegram.CallbackQuery) error {
+	if !bot.env.Conf.Bot.IsAdmin(q.From.ID) {
+		log.Printf("[bot] ignoring decision by non-admin user %v", &q.From)
+		return bot.client.AnswerCallbackQuery(q.ID, "You are not allowed to moderate posts.")
+	}
+	// previews are only known by message ID, which is unique within a chat
+	if q.Message == nil || !q.Message.Chat.Is(bot.env.Conf.Bot.AdminChat) {
+		log.Printf("[bot] ignoring decision by %v outside the admin chat", &q.From)
+		return bot.client.AnswerCallbackQuery(q.ID, "Posts are moderated in the admin chat.")
+	}
+
+	pending := bot.previews[q.Message.MessageID]
+	if pending == nil {
+		return bot.client.AnswerCallbackQuery(q.ID, "This preview has expired.")
+	}
+	msgID := q.Message.MessageID
+
+	var decision Decision
+	var status string
+	switch {
+	case q.Data == callbackPublish || q.Data == callbackConfirm:
+		if len(pending.dests) == 0 {
+			return bot.client.AnswerCallbackQuery(q.ID, "No destinations accept this category.")
+		}
+		if len(pending.warnings) > 0 {
+			if q.Data != callbackConfirm {
+				return bot.update(q, msgID, pending, "", bot.confirmButtons(), "This is a "+pending.warning()+" bookmark.")
+			}
+			pending.confirmed = true
+		}
+		decision, status = DecisionPublish, "✅ Published to "+describeDestinations(pending.dests)
+	case q.Data == callbackLater:
+		decision, status = DecisionLater, "⏸ Later"
+	case q.Data == callbackSkip:
+		decision, status = DecisionSkip, "🚫 Skipped permanently"
+	case q.Data == callbackCategories:
+		return bot.update(q, msgID, pending, "", bot.categoryButtons(), "")
+	case q.Data == callbackBack:
+		return bot.update(q, msgID, pending, "", bot.decisionButtons(pending), "")
+	case q.Data == callbackAddHN:
+		if pending.hnSuggestion == nil {
+			return bot.client.AnswerCallbackQuery(q.ID, "No HN discussion to add.")
+		}
+		bot.env.acceptHNSuggestion(pending)
+		return bot.update(q, msgID, pending, "", bot.decisionButtons(pending), "HN link added")
+	case q.Data == callbackFinalURLs:
+		pending.useFinalURLs()
+		return bot.update(q, msgID, pending, "", bot.decisionButtons(pending), "Using the final URLs")
+	case strings.HasPrefix(q.Data, callbackCategory):
+		i, err := strconv.Atoi(strings.TrimPrefix(q.Data, callbackCategory))
+		cats := bot.env.Conf.Content.Categories
+		if err != nil || i < 0 || i >= len(cats) {
+			return bot.client.AnswerCallbackQuery(q.ID, "Unknown category.")
+		}
+		bot.env.changeCategory(pending, cats[i])
+		return bot.update(q, msgID, pending, "", bot.decisionButtons(pending), "Category: "+cats[i].Title)
+	default:
+		return bot.client.AnswerCallbackQuery(q.ID, "Unknown action.")
+	}
+
+	log.Printf("[bot] %v decided %q on %s", &q.From, status, pending.cand.TitleOrURL())
+	if err := bot.env.decide(pending, decision); err != nil {
+		log.Printf("[bot] WARNING: %v", err)
+		return bot.update(q, msgID, pending, "⚠️ Failed: "+err.Error(), bot.decisionButtons(pending), "Failed")
+	}
+	delete(bot.previews, msgID)
+	return bot.update(q, msgID, pending, status, nil, status)
+}
+
+// update edits the preview message to reflect its new state, and
+// acknowledges the button press.
+func (bot *moderationBot) update(q *telegram.CallbackQuery, msgID int, pending *pendingPost, status string, buttons [][]telegram.InlineButton, notification string) error {
+	err := bot.client.EditMessageText(bot.env.Conf.Bot.AdminChat, msgID, bot.preview(pending, status, buttons))
+	if err != nil {
+		log.Printf("[bot] WARNING: cannot update preview: %v", err)
+	}
+	return bot.client.AnswerCallbackQuery(q.ID, notification)
+}
+
+func (bot *moderationBot) preview(pending *pendingPost, status string, buttons [][]telegram.InlineButton) *telegram.Message {
+	mode := bot.env.Conf.Destinations[0].ParseMode
+	if len(pending.dests) > 0 {
+		mode = pending.dests[0].ParseMode
+	}
+	f := formatterFor(mode)
+
+	var msg telegram.Message
+	for _, m := range buildTelegramMessages(pending.post, mode, bot.env.Conf.Content) {
+		if text, _ := m.Text(); text != "" {
+			msg = *m
+			break
+		}
+	}
+	msg.Photo = nil
+	msg.Buttons = buttons
+
+	if status == "" {
+		if len(pending.dests) > 0 {
+			status = "→ " + describeDestinations(pending.dests)
+		} else {
+			status = "→ no destinations accept " + pending.post.Category.Title
+		}
+		if s := pending.post.Options.String(); s != "" {
+			status += " (" + s + ")"
+		}
+		if s := pending.hnSummary(); s != "" {
+			status += "\nHN: " + s
+		}
+		if s := pending.hnSuggestionSummary(); s != "" {
+			status += "\nHN discussion found: " + s
+		}
+		if s := pending.post.Meta.String(); s != "" {
+			status += "\nℹ️ " + s
+		}
+		for _, s := range pending.brokenLinks() {
+			status += "\n⚠️ broken link: " + s
+		}
+		for _, s := range pending.redirects() {
+			status += "\n↪ " + s
+		}
+	}
+	if len(pending.warnings) > 0 {
+		status = "⚠️ " + pending.warning() + " bookmark\n" + status
+	}
+	if pending.post.Image != nil {
+		status = "🖼 " + pending.post.Image.URL + pending.post.Image.Path + "\n" + status
+	}
+	suffix := "\n" + f.Escape(status)
+	if mode == telegram.ParseModeHTML {
+		msg.HTMLText += suffix
+	} else {
+		msg.MarkdownText += suffix
+	}
+	return &msg
+}
+
+func (bot *moderationBot) decisionButtons(pending *pendingPost) [][]telegram.InlineButton {
+	rows := [][]telegram.InlineButton{
+		{
+			{Text: "Publish", CallbackData: callbackPublish},
+			{Text: "Later", CallbackData: callbackLater},
+			{Text: "Skip", CallbackData: callbackSkip},
+		},
+		{
+			{Text: "Change category", CallbackData: callbackCategories},
+		},
+	}
+	if pending.hnSuggestion != nil {
+		rows[1] = append(rows[1], telegram.InlineButton{Text: "Add HN link", CallbackData: callbackAddHN})
+	}
+	if len(pending.redirects()) > 0 {
+		rows[1] = append(rows[1], telegram.InlineButton{Text: "Use final URLs", CallbackData: callbackFinalURLs})
+	}
+	return rows
+}
+
+func (bot *moderationBot) confirmButtons() [][]telegram.InlineButton {
+	return [][]telegram.InlineButton{
+		{
+			{Text: "Publish anyway", CallbackData: callbackConfirm},
+			{Text: "« Back", CallbackData: callbackBack},
+		},
+	}
+}
+
+func (bot *moderationBot) categoryButtons() [][]telegram.InlineButton {
+	var rows [][]telegram.InlineButton
+	for i, cat := range bot.env.Conf.Content.Categories {
+		if i%2 == 0 {
+			rows = append(rows, nil)
+		}
+		rows[len(rows)-1] = append(rows[len(rows)-1], telegram.InlineButton{
+			Text:         cat.Title,
+			CallbackData: callbackCategory + strconv.Itoa(i),
+		})
+	}
+	return append(rows, []telegram.InlineButton{{Text: "« Back", CallbackData: callbackBack}})
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/telegram"
+)
+
+const (
+	testAdminID   = 1
+	testAdminChat = -100500
+)
+
+// fakeBotAPI records the calls the bot makes to moderate posts, and serves
+// the queued getUpdates results; an empty one, like running out of them,
+// fails the request.
+type fakeBotAPI struct {
+	*httptest.Server
+
+	mut     sync.Mutex
+	calls   []botCall
+	updates []string
+}
+
+type botCall struct {
+	Method string
+	Params map[string]interface{}
+}
+
+func newFakeBotAPI(t *testing.T) *fakeBotAPI {
+	api := &fakeBotAPI{}
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var params map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			t.Errorf("invalid %s body: %v", r.URL.Path, err)
+		}
+
+		api.mut.Lock()
+		defer api.mut.Unlock()
+		method := path.Base(r.URL.Path)
+		switch method {
+		case "getUpdates":
+			var result string
+			if len(api.updates) > 0 {
+				result, api.updates = api.updates[0], api.updates[1:]
+			}
+			if result == "" {
+				w.WriteHeader(http.StatusBadGateway)
+				w.Write([]byte(`{"ok":false,"error_code":502,"description":"Bad Gateway"}`))
+				return
+			}
+			fmt.Fprintf(w, `{"ok":true,"result":%s}`, result)
+		case "sendMessage":
+			api.calls = append(api.calls, botCall{method, params})
+			fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d}}`, 100+len(api.calls))
+		default:
+			api.calls = append(api.calls, botCall{method, params})
+			w.Write([]byte(`{"ok":true,"result":true}`))
+		}
+	}))
+	t.Cleanup(api.Close)
+	return api
+}
+
+// last returns the params of the latest call of the given method.
+func (api *fakeBotAPI) last(method string) map[string]interface{} {
+	api.mut.Lock()
+	defer api.mut.Unlock()
+	for i := len(api.calls) - 1; i >= 0; i-- {
+		if api.calls[i].Method == method {
+			return api.calls[i].Params
+		}
+	}
+	return nil
+}
+
+func newTestBot(t *testing.T, dests ...*Destination) (*moderationBot, *fakeTelegram, *fakeBotAPI) {
+	tg := newFakeTelegram(t)
+	t.Cleanup(tg.Close)
+	dests = append([]*Destination{{Key: ChannelTelegram, Chat: telegram.Chat{ID: "@chan"}, ParseMode: telegram.ParseModeMarkdownV2}}, dests...)
+	env := newDecideTestEnv(t, tg, false, dests...)
+	env.Conf.Content.Categories = append(env.Conf.Content.Categories, &Category{Tags: []string{"fun"}, Title: "Fun"})
+	env.Conf.Bot = BotOptions{
+		AdminChat:    telegram.Chat{ID: fmt.Sprint(testAdminChat)},
+		AdminUserIDs: []int64{testAdminID},
+	}
+
+	api := newFakeBotAPI(t)
+	client := *env.Telegram
+	client.BaseURL = api.URL
+	client.MaxRetries = 0
+	bot := &moderationBot{
+		env:      env,
+		client:   &client,
+		previews: make(map[int]*pendingPost),
+	}
+	return bot, tg, api
+}
+
+// sendTestPreview sends the preview of a bookmark tagged as tools to
+// the admin chat and returns its message ID.
+func sendTestPreview(t *testing.T, bot *moderationBot, url string, private bool) int {
+	pending, err := bot.env.prepare(&Candidate{URL: url, Title: "Title of " + url, Tags: []string{"ytn", "tools"}, Private: private})
+	if err != nil || pending == nil {
+		t.Fatalf("prepare(%s) = %v, %v", url, pending, err)
+	}
+	if err := bot.sendPreview(pending); err != nil {
+		t.Fatal(err)
+	}
+	for id, p := range bot.previews {
+		if p == pending {
+			return id
+		}
+	}
+	panic("unreachable")
+}
+
+func press(bot *moderationBot, from int64, chat int64, msgID int, data string) error {
+	return bot.handleUpdate(&telegram.Update{CallbackQuery: &telegram.CallbackQuery{
+		ID:      "q",
+		From:    telegram.User{ID: from},
+		Message: &telegram.IncomingMessage{MessageID: msgID, Chat: telegram.ChatInfo{ID: chat}},
+		Data:    data,
+	}})
+}
+
+func answer(api *fakeBotAPI) interface{} {
+	return api.last("answerCallbackQuery")["text"]
+}
+
+func TestBotIgnoresNonAdmins(t *testing.T) {
+	bot, tg, api := newTestBot(t)
+	id := sendTestPreview(t, bot, "https://example.com/a", false)
+
+	if err := press(bot, 2, testAdminChat, id, callbackPublish); err != nil {
+		t.Fatal(err)
+	}
+	if a := answer(api); a != "You are not allowed to moderate posts." {
+		t.Errorf("non-admin press answered %q", a)
+	}
+	if err := press(bot, testAdminID, 777, id, callbackPublish); err != nil {
+		t.Fatal(err)
+	}
+	if a := answer(api); a != "Posts are moderated in the admin chat." {
+		t.Errorf("press outside the admin chat answered %q", a)
+	}
+	if len(tg.sent) != 0 || bot.previews[id] == nil {
+		t.Errorf("sent %d messages, wanted the post to stay pending", len(tg.sent))
+	}
+
+	err := bot.handleUpdate(&telegram.Update{Message: &telegram.IncomingMessage{
+		MessageID: 5,
+		From:      &telegram.User{ID: 2},
+		Chat:      telegram.ChatInfo{ID: 2, Type: "private"},
+		Text:      "https://example.com/b #tools",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := api.last("sendMessage")["text"]; text != telegram.Escape("Sorry, only admins can submit links.") {
+		t.Errorf("replied %q to a non-admin submission", text)
+	}
+	if len(bot.env.State.Submissions) != 0 {
+		t.Errorf("submissions = %v, wanted none", bot.env.State.Submissions)
+	}
+}
+
+func TestBotPublishesAndSkips(t *testing.T) {
+	bot, tg, api := newTestBot(t)
+	a := sendTestPreview(t, bot, "https://example.com/a", false)
+	b := sendTestPreview(t, bot, "https://example.com/b", false)
+
+	if err := press(bot, testAdminID, testAdminChat, a, callbackPublish); err != nil {
+		t.Fatal(err)
+	}
+	if len(tg.sent) != 1 || bot.env.State.LookupArticle("https://example.com/a").Channels[ChannelTelegram] == nil {
+		t.Errorf("sent %d messages, wanted post a published", len(tg.sent))
+	}
+	if text, _ := api.last("editMessageText")["text"].(string); !strings.Contains(text, "Published to") {
+		t.Errorf("preview = %q, wanted the published status", text)
+	}
+
+	if err := press(bot, testAdminID, testAdminChat, b, callbackSkip); err != nil {
+		t.Fatal(err)
+	}
+	if len(tg.sent) != 1 || !bot.env.State.LookupArticle("https://example.com/b").Skip {
+		t.Errorf("sent %d messages, wanted post b skipped", len(tg.sent))
+	}
+	if len(bot.previews) != 0 {
+		t.Errorf("%d previews still pending, wanted none", len(bot.previews))
+	}
+
+	if err := press(bot, testAdminID, testAdminChat, a, callbackPublish); err != nil {
+		t.Fatal(err)
+	}
+	if a := answer(api); a != "This preview has expired." || len(tg.sent) != 1 {
+		t.Errorf("pressing a decided preview answered %q after %d messages", a, len(tg.sent))
+	}
+}
+
+func TestBotConfirmsPrivateBookmarks(t *testing.T) {
+	bot, tg, api := newTestBot(t)
+	id := sendTestPreview(t, bot, "https://example.com/a", true)
+
+	if err := press(bot, testAdminID, testAdminChat, id, callbackPublish); err != nil {
+		t.Fatal(err)
+	}
+	if len(tg.sent) != 0 {
+		t.Fatalf("sent %d messages, wanted a confirmation first", len(tg.sent))
+	}
+	if markup, _ := json.Marshal(api.last("editMessageText")["reply_markup"]); !strings.Contains(string(markup), `"callback_data":"confirm"`) {
+		t.Errorf("reply_markup = %s, wanted a confirmation button", markup)
+	}
+
+	if err := press(bot, testAdminID, testAdminChat, id, callbackConfirm); err != nil {
+		t.Fatal(err)
+	}
+	if len(tg.sent) != 1 {
+		t.Errorf("sent %d messages after confirming, wanted 1", len(tg.sent))
+	}
+}
+
+func TestBotChangesCategory(t *testing.T) {
+	fun := &Destination{Key: "fun", Chat: telegram.Chat{ID: "@fun"}, ParseMode: telegram.ParseModeMarkdownV2, CategoryTags: []string{"fun"}}
+	bot, tg, api := newTestBot(t, fun)
+	id := sendTestPreview(t, bot, "https://example.com/a", false)
+
+	if err := press(bot, testAdminID, testAdminChat, id, callbackCategories); err != nil {
+		t.Fatal(err)
+	}
+	if markup, _ := json.Marshal(api.last("editMessageText")["reply_markup"]); !strings.Contains(string(markup), `"callback_data":"cat:1"`) {
+		t.Errorf("reply_markup = %s, wanted the category buttons", markup)
+	}
+
+	if err := press(bot, testAdminID, testAdminChat, id, callbackCategory+"1"); err != nil {
+		t.Fatal(err)
+	}
+	if a := answer(api); a != "Category: Fun" {
+		t.Errorf("category change answered %q", a)
+	}
+	pending := bot.previews[id]
+	if actual := describeDestinations(pending.dests); pending.post.Category.Title != "Fun" || actual != describeDestinations(bot.env.Conf.Destinations) {
+		t.Errorf("category = %s, destinations = %s, wanted Fun in all destinations", pending.post.Category.Title, actual)
+	}
+
+	if err := press(bot, testAdminID, testAdminChat, id, callbackPublish); err != nil {
+		t.Fatal(err)
+	}
+	var chats []interface{}
+	for _, msg := range tg.sent {
+		chats = append(chats, msg["chat_id"])
+	}
+	if expected := []interface{}{"@chan", "@fun"}; !reflect.DeepEqual(chats, expected) {
+		t.Errorf("sent to %v, wanted %v", chats, expected)
+	}
+}
+
+func TestBotKeepsPollingAfterErrors(t *testing.T) {
+	bot, _, api := newTestBot(t)
+	id := sendTestPreview(t, bot, "https://example.com/a", false)
+	api.updates = []string{
+		"",
+		"",
+		fmt.Sprintf(`[{"update_id":1,"callback_query":{"id":"q","from":{"id":%d},"message":{"message_id":%d,"chat":{"id":%d}},"data":"later"}}]`, testAdminID, id, testAdminChat),
+	}
+
+	// the first failure after the update ends the loop
+	var sleeps []time.Duration
+	done := make(chan struct{})
+	bot.sleep = func(d time.Duration) {
+		sleeps = append(sleeps, d)
+		if len(sleeps) == 3 {
+			close(done)
+			runtime.Goexit()
+		}
+	}
+	go bot.loop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("bot stopped polling")
+	}
+
+	if a := answer(api); a != "⏸ Later" {
+		t.Errorf("answered %q, wanted the update handled", a)
+	}
+	if expected := []time.Duration{time.Second, 2 * time.Second, time.Second}; !reflect.DeepEqual(sleeps, expected) {
+		t.Errorf("sleeps = %v, wanted %v", sleeps, expected)
+	}
+}
+
+func TestBotAcceptsCorrectedSubmission(t *testing.T) {
+	bot, _, api := newTestBot(t)
+	submit := func(text string) interface{} {
+		err := bot.handleUpdate(&telegram.Update{Message: &telegram.IncomingMessage{
+			MessageID: 5,
+			From:      &telegram.User{ID: testAdminID},
+			Chat:      telegram.ChatInfo{ID: testAdminID, Type: "private"},
+			Text:      text,
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return api.last("sendMessage")["text"]
+	}
+
+	if reply := submit("https://example.com/b"); reply != telegram.Escape("Cannot add this: add a category hashtag.") {
+		t.Errorf("replied %q to a submission without a category", reply)
+	}
+	if len(bot.env.State.Submissions) != 0 {
+		t.Errorf("submissions = %v, wanted none", bot.env.State.Submissions)
+	}
+
+	if reply := submit("https://example.com/b\n#tools"); reply != telegram.Escape("Added, see the preview in the admin chat.") {
+		t.Errorf("replied %q to the corrected submission", reply)
+	}
+	if len(bot.env.State.Submissions) != 1 || len(bot.previews) != 1 {
+		t.Errorf("submissions = %v with %d previews, wanted the link added", bot.env.State.Submissions, len(bot.previews))
+	}
+}
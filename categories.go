@@ -1,8 +1,9 @@
 package main
 
 type Category struct {
-	Tags  []string
-	Title string
+	Tags    []string
+	Title   string
+	Preview *PreviewOptions
 }
 
 func (cat *Category) PreferredTag() string {
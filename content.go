@@ -2,11 +2,13 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
 
-	"github.com/andreyvit/yesterdaytechnewsbot/internal/pinboard"
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/enrich"
 	"github.com/andreyvit/yesterdaytechnewsbot/internal/telegram"
 )
 
@@ -17,8 +19,34 @@ type ContentOptions struct {
 	TrimTagPrefixes []string
 	StickyLinks     []string
 	Categories      []*Category
+	LongMessages    LongMessageMode
+	PreviewTag      string
+	// ImageDir is the only directory local images can be uploaded from
+	ImageDir string
+
+	// StickyLinkButtons renders sticky links as inline keyboard buttons
+	// under the message instead of links in the text.
+	StickyLinkButtons bool
+	LinkLabels        map[string]LinkLabel
 }
 
+type LinkLabel struct {
+	Label string
+	Emoji string
+}
+
+// LongMessageMode says what to do with a post that exceeds Telegram's
+// message length limit.
+type LongMessageMode string
+
+const (
+	// LongMessageTruncate cuts the description at a paragraph boundary,
+	// keeping the sticky links and tags.
+	LongMessageTruncate LongMessageMode = "truncate"
+	// LongMessageSplit posts the remainder as a chain of replies.
+	LongMessageSplit LongMessageMode = "split"
+)
+
 type Post struct {
 	URL         string
 	Title       string
@@ -29,64 +57,158 @@ type Post struct {
 	Description []*Region
 	Links       map[string]string
 	StickyLinks []Link
+	LinkButtons []Link
+	Preview     *PreviewOptions
+	Image       *telegram.Photo
+	Options     PostOptions
+	// Meta is what the enrichers have found out about the URL, if anything
+	Meta *enrich.Metadata
 }
 
 type Link struct {
 	Key string
 	URL string
+	// Comments, if known, is shown next to the link
+	Comments int
+}
+
+func (link Link) text() string {
+	return strings.ReplaceAll(link.Key, "_", " ") + link.commentsSuffix()
+}
+
+func (link Link) commentsSuffix() string {
+	if link.Comments == 0 {
+		return ""
+	}
+	return " (" + pluralize(link.Comments, "comment") + ")"
 }
 
 const (
-	LinkNameHN = "HN"
+	LinkNameHN    = "HN"
+	LinkNameImage = "image"
+	LinkNamePDF   = "PDF"
 )
 
 var (
-	hckrnewsRe = regexp.MustCompile(`^https://news.ycombinator.com/item\?id=\d+$`)
-	linkRe     = regexp.MustCompile(`^([A-Za-z0-9_-]+): (https?://.*)$`)
+	hckrnewsRe  = regexp.MustCompile(`^https://news.ycombinator.com/item\?id=\d+$`)
+	linkRe      = regexp.MustCompile(`^([A-Za-z0-9_-]+): (https?://.*)$`)
+	imagePathRe = regexp.MustCompile(`^(` + LinkNameImage + `): ((?:/|~/|\./|file://).+)$`)
 )
 
-func parsePost(pp *pinboard.Post, opt ContentOptions) (*Post, error) {
+func (post *Post) addStickyLink(link Link, opt ContentOptions) {
+	if opt.StickyLinkButtons {
+		post.LinkButtons = append(post.LinkButtons, link)
+	} else {
+		post.StickyLinks = append(post.StickyLinks, link)
+	}
+}
+
+// insertStickyLink adds a link after the parsing, keeping the links in the
+// order of opt.StickyLinks.
+func (post *Post) insertStickyLink(link Link, opt ContentOptions) {
+	links := &post.StickyLinks
+	if opt.StickyLinkButtons {
+		links = &post.LinkButtons
+	}
+	rank := func(key string) int {
+		for i, k := range opt.StickyLinks {
+			if k == key {
+				return i
+			}
+		}
+		return len(opt.StickyLinks)
+	}
+	i := 0
+	for i < len(*links) && rank((*links)[i].Key) <= rank(link.Key) {
+		i++
+	}
+	*links = append(*links, Link{})
+	copy((*links)[i+1:], (*links)[i:])
+	(*links)[i] = link
+}
+
+func parsePost(c *Candidate, opt ContentOptions) (*Post, error) {
+	var err error
 	post := &Post{
-		URL:   pp.URL,
-		Title: pp.Title,
-		Time:  pp.Time,
+		URL:   c.URL,
+		Title: c.Title,
+		Time:  c.Time,
 		Links: make(map[string]string),
 	}
 
-	desc, links := parseTrailingLinks(pp.Description)
+	desc, links, directives := parseTrailingLinks(c.Description)
+	post.Options, err = parseDirectives(directives)
+	if err != nil {
+		return nil, err
+	}
+	if post.Options.NoHN {
+		delete(links, LinkNameHN)
+	}
+	previewURL := links[LinkNamePreview]
+	delete(links, LinkNamePreview)
+	if image, ok := links[LinkNameImage]; ok {
+		delete(links, LinkNameImage)
+		post.Image, err = parseImageLink(image, opt.ImageDir)
+		if err != nil {
+			return nil, err
+		}
+	}
 	post.Links = links
 
 	post.Description = ParseExplicitLinks(strings.TrimSpace(desc), links)
 
 	for _, key := range opt.StickyLinks {
 		if url, ok := links[key]; ok {
-			post.StickyLinks = append(post.StickyLinks, Link{
-				Key: key,
-				URL: url,
-			})
+			post.addStickyLink(Link{Key: key, URL: url}, opt)
 		}
 	}
 
-	tags := []string(pp.Tags)
-	post.Category = DetermineCategoryByTags(opt.Categories, tags)
+	tags := c.Tags
+	var preview *PreviewOptions
+	if tag := post.Options.Category; tag != "" {
+		post.Category = categoryByTag(opt.Categories, tag)
+		if post.Category == nil {
+			return nil, fmt.Errorf("!category=%s: no such category", tag)
+		}
+	} else {
+		post.Category = DetermineCategoryByTags(opt.Categories, tags)
+	}
 	if post.Category != nil {
 		tags = removeTags(tags, post.Category.Tags)
+		preview = post.Category.Preview
+	}
+	post.TitleIsLink = strings.HasPrefix(post.URL, "https://news.ycombinator.com/")
+
+	preview, tags = applyPreviewTags(preview, tags, opt.PreviewTag)
+	if preview == nil && post.Options.Preview {
+		preview = new(PreviewOptions)
+	}
+	if preview != nil {
+		cp := *preview
+		if previewURL != "" {
+			cp.URL = previewURL
+		} else if cp.URL == "" && !post.TitleIsLink {
+			// the URL of an HN bookmark is the discussion, so its article
+			// is filled in by the HN lookup
+			cp.URL = c.URL
+		}
+		post.Preview = &cp
 	}
 	tags = renameTags(tags, opt.TagRenames)
 	post.Tags = parseTags(tags, opt)
 
-	post.TitleIsLink = strings.HasPrefix(post.URL, "https://news.ycombinator.com/")
-
 	return post, nil
 }
 
-func parseTrailingLinks(desc string) (string, map[string]string) {
+// parseTrailingLinks splits off the trailing "key: url" lines and
+// directive lines like "!silent !pin" from the description.
+func parseTrailingLinks(desc string) (string, map[string]string, []string) {
 	links := make(map[string]string)
+	var directives []string
 
-	if !strings.Contains(desc, "\n\n") {
-		// avoid parsing post URL as Hacker News link for posts like Ask HN
-		return strings.TrimSpace(desc), links
-	}
+	// avoid parsing post URL as Hacker News link for posts like Ask HN, and
+	// a line ending the only paragraph as directives unless it's all there is
+	linksAllowed := strings.Contains(desc, "\n\n")
 
 	lines := strings.Split(strings.TrimSpace(desc), "\n")
 	cont := true
@@ -94,17 +216,76 @@ func parseTrailingLinks(desc string) (string, map[string]string) {
 		line := strings.TrimSpace(lines[len(lines)-1])
 		if line == "" {
 			cont = false
-		} else if hckrnewsRe.MatchString(line) {
-			links["HN"] = line
+		} else if (linksAllowed || len(lines) == 1) && isDirectiveLine(line) {
+			directives = append(strings.Fields(line), directives...)
+		} else if !linksAllowed {
+			break
+		} else if site := recognizeDiscussion(line); site != nil {
+			links[site.Key] = line
 		} else if m := linkRe.FindStringSubmatch(line); m != nil {
 			links[m[1]] = m[2]
+		} else if m := imagePathRe.FindStringSubmatch(line); m != nil {
+			links[m[1]] = m[2]
 		} else {
 			break
 		}
 		lines = lines[:len(lines)-1]
 	}
 
-	return strings.TrimSpace(strings.Join(lines, "\n")), links
+	return strings.TrimSpace(strings.Join(lines, "\n")), links, directives
+}
+
+// parseImageLink accepts local paths only inside the image directory, since
+// descriptions can come from untrusted sources like bot submissions and feeds.
+// Whether the file exists is checked by checkImage.
+func parseImageLink(link, dir string) (*telegram.Photo, error) {
+	if strings.HasPrefix(link, "http://") || strings.HasPrefix(link, "https://") {
+		return &telegram.Photo{URL: link}, nil
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("image %s: local images need an image directory", link)
+	}
+
+	path := strings.TrimPrefix(link, "file://")
+	if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("image %s: %w", link, err)
+		}
+		path = filepath.Join(home, path[2:])
+	} else if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path = filepath.Clean(path)
+	if !isWithinDir(path, dir) {
+		return nil, fmt.Errorf("image %s: not in the image directory %s", link, dir)
+	}
+	return &telegram.Photo{Path: path}, nil
+}
+
+// checkImage verifies that a local image exists and, with the symlinks
+// resolved, is still inside the image directory.
+func checkImage(photo *telegram.Photo, dir string) error {
+	if photo == nil || photo.Path == "" {
+		return nil
+	}
+	path, err := filepath.EvalSymlinks(photo.Path)
+	if err != nil {
+		return fmt.Errorf("image: %w", err)
+	}
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fmt.Errorf("image directory: %w", err)
+	}
+	if !isWithinDir(path, dir) {
+		return fmt.Errorf("image %s: not in the image directory %s", photo.Path, dir)
+	}
+	return nil
+}
+
+func isWithinDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
 }
 
 func parseTags(tags []string, opt ContentOptions) []string {
@@ -137,81 +318,75 @@ func parseTags(tags []string, opt ContentOptions) []string {
 	return result
 }
 
-func buildTelegramMarkdown(p *Post) string {
-	var buf strings.Builder
-	// buf.WriteString(telegram.EscapeReserved(telegram.EscapeForMarkdown(time.Now().Format(time.RFC3339))) + "\n")
+func buildTelegramMessages(p *Post, mode telegram.ParseMode, opt ContentOptions) []*telegram.Message {
+	t := newTelegramText(p, formatterFor(mode))
+	var texts []string
+	switch opt.LongMessages {
+	case LongMessageSplit:
+		texts = t.Split(telegram.MaxMessageLength)
+	default:
+		texts = []string{t.Truncate(telegram.MaxMessageLength)}
+	}
 
-	if p.TitleIsLink && p.Title != "" {
-		buf.WriteString(telegramBold(telegramLink(telegram.Escape(p.Title), p.URL)))
-		buf.WriteByte('\n')
-	} else {
-		if p.Title != "" {
-			buf.WriteString(telegramBold(telegram.Escape(p.Title)))
-			buf.WriteByte('\n')
+	msgs := make([]*telegram.Message, 0, len(texts))
+	for _, text := range texts {
+		if mode == telegram.ParseModeHTML {
+			msgs = append(msgs, &telegram.Message{HTMLText: text})
+		} else {
+			msgs = append(msgs, &telegram.Message{MarkdownText: text})
 		}
-		buf.WriteString(telegramLink(telegram.Escape(prettifyURL(p.URL)), p.URL))
-		buf.WriteByte('\n')
 	}
-	if d := strings.TrimSpace(buildDescriptionMarkdown(p)); d != "" {
-		buf.WriteByte('\n')
-		buf.WriteString(d)
-		buf.WriteByte('\n')
+	msgs[0].LinkPreview = p.Preview.telegramOptions()
+	for _, msg := range msgs {
+		msg.Silent = p.Options.Silent
 	}
-	return buf.String()
-}
+	msgs[len(msgs)-1].Buttons = buildLinkButtons(p.LinkButtons, opt.LinkLabels)
 
-func telegramBold(text string) string {
-	return fmt.Sprintf("*%s*", text)
-}
-
-func telegramLink(title, url string) string {
-	return fmt.Sprintf("[%s](%s)", title, telegram.Escape(url))
-}
-
-func buildDescriptionMarkdown(p *Post) string {
-	linksUsed := make(map[string]bool)
-
-	var descBuilder strings.Builder
-	for _, r := range p.Description {
-		if r.PrimaryOccurrance && r.LinkKey != "" {
-			linksUsed[r.LinkKey] = true
-		}
-		if r.PrimaryOccurrance && r.LinkValue != "" {
-			descBuilder.WriteString(telegramLink(telegram.EscapeExceptFormatting(r.Text), r.LinkValue))
+	if p.Image != nil {
+		// use the text as a caption if it fits, otherwise post the photo alone first
+		if len(msgs) == 1 && telegram.TextLength(texts[0], mode) <= telegram.MaxCaptionLength {
+			msgs[0].Photo = p.Image
 		} else {
-			descBuilder.WriteString(telegram.EscapeExceptFormatting(r.Text))
+			msgs = append([]*telegram.Message{{Photo: p.Image, Silent: p.Options.Silent}}, msgs...)
 		}
 	}
-	desc := descBuilder.String()
-
-	// TODO: format explicit links
-
-	var tags []string
-	if p.Category != nil {
-		tags = append(tags, p.Category.PreferredTag())
-	}
-	tags = append(tags, p.Tags...)
+	return msgs
+}
 
-	var trailers []string
-	for _, link := range p.StickyLinks {
-		trailers = append(trailers, telegramLink(telegram.Escape(strings.ReplaceAll(link.Key, "_", " ")), link.URL))
-	}
-	if len(tags) > 0 {
-		trailers = append(trailers, telegram.Escape(buildTags(tags)))
-	}
+const maxButtonsPerRow = 3
 
-	isMultiParagraph := strings.Contains(desc, "\n\n")
-	if fragment := strings.Join(trailers, " · "); fragment != "" {
-		if isMultiParagraph || isSpecialLine(lastLine(splitLines(desc))) {
-			desc = desc + "\n\n" + fragment
-		} else if desc != "" {
-			desc = desc + "\n" + fragment
-		} else {
-			desc = fragment
+func buildLinkButtons(links []Link, labels map[string]LinkLabel) [][]telegram.InlineButton {
+	var rows [][]telegram.InlineButton
+	for i, link := range links {
+		if i%maxButtonsPerRow == 0 {
+			rows = append(rows, nil)
+		}
+		label, ok := labels[link.Key]
+		if site := discussionSiteByKey(link.Key); site != nil && !ok {
+			label = LinkLabel{Label: site.Label, Emoji: site.Emoji}
+		}
+		text := label.Label
+		if text == "" {
+			text = strings.ReplaceAll(link.Key, "_", " ")
 		}
+		text += link.commentsSuffix()
+		if label.Emoji != "" {
+			text = label.Emoji + " " + text
+		}
+		rows[len(rows)-1] = append(rows[len(rows)-1], telegram.InlineButton{
+			Text: text,
+			URL:  link.URL,
+		})
 	}
+	return rows
+}
 
-	return desc
+func buildTelegramMarkdown(p *Post) string {
+	return newTelegramText(p, markdownFormatter{}).String()
+}
+
+func buildTelegramHTML(p *Post) string {
+	return newTelegramText(p, htmlFormatter{}).String()
 }
 
 func buildTags(tags []string) string {
@@ -246,10 +421,7 @@ func isSpecialLine(line string) bool {
 		return true
 	}
 	c := line[0]
-	if c == '*' || c == '-' || c == '>' || c == '#' {
-		return true
-	}
-	return false
+	return c == '*' || c == '-' || c == '>' || c == '#'
 }
 
 func prettifyURL(link string) string {
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/telegram"
+)
+
+func TestBuildLinkButtons(t *testing.T) {
+	labels := map[string]LinkLabel{
+		"HN":    {Label: "Discuss", Emoji: "🗣"},
+		"paper": {Label: "Paper"},
+	}
+	tests := []struct {
+		Links    []Link
+		Expected [][]telegram.InlineButton
+	}{
+		{nil, nil},
+		{
+			[]Link{{Key: "HN", URL: "https://hn/1", Comments: 312}},
+			[][]telegram.InlineButton{{{Text: "🗣 Discuss (312 comments)", URL: "https://hn/1"}}},
+		},
+		{
+			[]Link{{Key: "Lobsters", URL: "https://lobsters/1"}, {Key: "paper", URL: "https://paper/1"}, {Key: "GitHub_issue", URL: "https://gh/1"}, {Key: "old_site", URL: "https://old/1"}},
+			[][]telegram.InlineButton{
+				{{Text: "🦞 Lobsters", URL: "https://lobsters/1"}, {Text: "Paper", URL: "https://paper/1"}, {Text: "🐙 GitHub issue", URL: "https://gh/1"}},
+				{{Text: "old site", URL: "https://old/1"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		actual := buildLinkButtons(test.Links, labels)
+		if !reflect.DeepEqual(actual, test.Expected) {
+			t.Errorf("buildLinkButtons(%v) = %q, wanted %q", test.Links, actual, test.Expected)
+		}
+	}
+}
@@ -3,8 +3,12 @@ package main
 import (
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/enrich"
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/hn"
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/linkcheck"
 	"github.com/andreyvit/yesterdaytechnewsbot/internal/pinboard"
 	"github.com/andreyvit/yesterdaytechnewsbot/internal/telegram"
 )
@@ -12,124 +16,396 @@ import (
 type Configuration struct {
 	Pinboard     pinboard.Options
 	Telegram     telegram.Options
+	Destinations []*Destination
+	Sources      SourceOptions
+	HN           HNOptions
+	Enrich       EnrichOptions
+	LinkCheck    LinkCheckOptions
+	StatusTags   StatusTagOptions
+	Bot          BotOptions
 	Content      ContentOptions
 	StateFile    string
 	RepublishAll bool
+
+	// PublishPrivate and PublishUnread allow publishing private and to-read
+	// bookmarks without an extra confirmation.
+	PublishPrivate bool
+	PublishUnread  bool
 }
 
 type Env struct {
-	Conf  Configuration
-	IO    *IO
-	State *State
+	Conf      Configuration
+	IO        IO
+	State     *State
+	Pinboard  *pinboard.Client
+	Telegram  *telegram.Client
+	HN        *hn.Client
+	Enrich    *enrich.Pipeline
+	LinkCheck *linkcheck.Checker
+	Sources   []Source
 }
 
 var (
 	ErrQuit = fmt.Errorf("quit")
 )
 
-func Run(conf Configuration) error {
+// Decision is what to do with a pending post. The values double as
+// the prompt choices.
+type Decision rune
+
+const (
+	DecisionPublish Decision = 'P'
+	DecisionLater   Decision = 'L'
+	DecisionSkip    Decision = 'S'
+	DecisionQuit    Decision = 'Q'
+)
+
+// pendingPost is a candidate that is ready to be published to at least
+// one destination, awaiting a decision.
+type pendingPost struct {
+	cand         *Candidate
+	post         *Post
+	state        *ArticleState
+	dests        []*Destination
+	republishing bool
+	// warnings are the flags of the bookmark that have to be confirmed
+	// before publishing, like "private"
+	warnings  []string
+	confirmed bool
+	hn        *hn.Item
+	// hnSuggestion is the HN discussion found for a post without an HN link
+	hnSuggestion *hn.Hit
+	linkChecks   []*linkcheck.Result
+}
+
+func newEnv(conf Configuration) (*Env, error) {
 	env := &Env{
-		Conf: conf,
-		IO:   NewIO(),
+		Conf:      conf,
+		IO:        NewIO(),
+		Pinboard:  pinboard.NewClient(conf.Pinboard),
+		Telegram:  telegram.NewClient(conf.Telegram),
+		HN:        hn.NewClient(conf.HN.Options),
+		Enrich:    enrich.NewPipeline(conf.Enrich.Options),
+		LinkCheck: linkcheck.NewChecker(conf.LinkCheck.Options),
 	}
 
 	state, err := ReadState(conf.StateFile)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	env.State = state
+	env.Sources = env.sources()
+
+	return env, nil
+}
 
-	posts, err := pinboard.LoadRecent(pinboard.RecentRequest{}, conf.Pinboard)
+func Run(conf Configuration) error {
+	env, err := newEnv(conf)
 	if err != nil {
 		return err
 	}
+	return env.Run()
+}
 
-	for _, post := range posts {
-		if !post.Tags.Contains("ytn") {
-			log.Println()
-			log.Printf("IGNORING: %s", post.TitleOrURL())
-			continue
-		}
-		err := env.handle(post, conf)
+// Run reviews the pending candidates one by one, prompting via env.IO.
+func (env *Env) Run() error {
+	conf := env.Conf
+	cands, err := loadCandidates(env.Sources)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range cands {
+		err := env.handle(c, conf)
 		if err == ErrQuit {
 			break
 		} else if err != nil {
-			return fmt.Errorf("%v [while handling: %s]", err, post.TitleOrURL())
+			return fmt.Errorf("%v [while handling: %s]", err, c.TitleOrURL())
 		}
 	}
 
 	return nil
 }
 
-func (env *Env) handle(pp *pinboard.Post, conf Configuration) error {
-	as := env.State.LookupArticle(pp.URL)
-	if as.Skip {
-		log.Printf("SKIPPED:\n%v\n", pp)
-		return nil
+func (env *Env) handle(c *Candidate, conf Configuration) error {
+	pending, err := env.prepare(c)
+	if err != nil || pending == nil {
+		return err
 	}
 
-	log.Println()
-	if as.Channels[ChannelTelegram] != nil {
-		if conf.RepublishAll {
-			log.Printf("REPUBLISHING:\n%v\n", pp)
+	if s := pending.hnSuggestionSummary(); s != "" {
+		log.Printf("HN DISCUSSION FOUND: %s", s)
+		if env.IO.Prompt("Add this HN link?", 'Y', 'N', "Yes", "No") == 'Y' {
+			env.acceptHNSuggestion(pending)
+		}
+	}
+	for _, s := range pending.brokenLinks() {
+		log.Printf("BROKEN LINK: %s", s)
+	}
+	if redirects := pending.redirects(); len(redirects) > 0 {
+		for _, s := range redirects {
+			log.Printf("REDIRECT: %s", s)
+		}
+		if env.IO.Prompt("Use the final URLs in the message?", 'Y', 'N', "Yes", "No") == 'Y' {
+			pending.useFinalURLs()
+		}
+	}
+
+	msgs := buildTelegramMessages(pending.post, pending.dests[0].ParseMode, conf.Content)
+	for i, msg := range msgs {
+		text, _ := msg.Text()
+		if msg.Photo != nil {
+			log.Printf("TELEGRAM PHOTO: %s%s", msg.Photo.URL, msg.Photo.Path)
+		}
+		if text == "" {
+			continue
+		} else if len(msgs) > 1 {
+			log.Printf("TELEGRAM MESSAGE %d/%d:\n%s", i+1, len(msgs), indent(text))
 		} else {
-			// log.Printf("ALREADY PUBLISHED:\n%v\n", pp)
+			log.Printf("TELEGRAM MESSAGE:\n%s", indent(text))
+		}
+	}
+	log.Printf("LINK PREVIEW: %v", pending.post.Preview)
+	if s := pending.post.Options.String(); s != "" {
+		log.Printf("OPTIONS: %s", s)
+	}
+	if s := pending.hnSummary(); s != "" {
+		log.Printf("HN: %s", s)
+	}
+	if pending.post.Meta != nil {
+		log.Printf("META: %v", pending.post.Meta)
+	}
+	log.Printf("DESTINATIONS: %s", describeDestinations(pending.dests))
+	if len(pending.warnings) > 0 {
+		log.Printf("WARNING: this is a %s bookmark", pending.warning())
+	}
+
+	decision := Decision(env.IO.Prompt("Publish to Telegram?", 0, 'L', "Publish", "Later", "Skip permanently", "Quit"))
+	if decision == DecisionPublish && len(pending.warnings) > 0 {
+		prompt := fmt.Sprintf("This is a %s bookmark. Publish anyway?", pending.warning())
+		if env.IO.Prompt(prompt, 'N', 'N', "Yes", "No") != 'Y' {
 			return nil
 		}
-	} else {
-		log.Printf("PUBLISHING:\n%v\n", pp)
+		pending.confirmed = true
+	}
+	return env.decide(pending, decision)
+}
+
+// prepare parses the candidate and figures out where it should be published,
+// returning nil if there's nothing to publish.
+func (env *Env) prepare(c *Candidate) (*pendingPost, error) {
+	conf := env.Conf
+	as := env.State.LookupArticle(c.URL)
+	if as.Skip {
+		log.Printf("SKIPPED:\n%v\n", c)
+		return nil, nil
 	}
 
-	post, err := parsePost(pp, conf.Content)
+	if !conf.RepublishAll && as.IsPublishedToAll(conf.Destinations) {
+		// log.Printf("ALREADY PUBLISHED:\n%v\n", c)
+		return nil, nil
+	}
+
+	post, err := parsePost(c, conf.Content)
+	if err == nil {
+		err = checkTopics(post.Options, conf.Destinations)
+	}
 	if err != nil {
-		return err
+		// one bad description must not hold up the rest
+		log.Println()
+		log.Printf("SKIPPED, %v:\n%v\n", err, c)
+		return nil, nil
 	}
 
 	if post.Category == nil {
 		log.Println()
-		log.Printf("NO CATEGORY:\n%v\n", pp)
-		return nil
+		log.Printf("NO CATEGORY:\n%v\n", c)
+		return nil, nil
+	}
+	if err := checkImage(post.Image, conf.Content.ImageDir); err != nil {
+		log.Println()
+		log.Printf("SKIPPED, %v:\n%v\n", err, c)
+		return nil, nil
 	}
 
-	msg := &telegram.Message{
-		// MarkdownText: fmt.Sprintf("Hello **world!**\nOn %s", time.Now().Format(time.RFC3339)),
-		MarkdownText: buildTelegramMarkdown(post),
+	pending := &pendingPost{
+		cand:     c,
+		post:     post,
+		state:    as,
+		warnings: env.warnings(c),
+	}
+	pending.updateDestinations(conf)
+	if len(pending.dests) == 0 {
+		return nil, nil
 	}
+	pending.hn = env.lookupHN(post)
+	env.previewArticle(post)
+	pending.hnSuggestion = env.discoverHN(post)
+	env.enrich(post)
+	pending.linkChecks = env.checkLinks(post)
 
-	log.Printf("TELEGRAM MESSAGE:\n%s", indent(msg.MarkdownText))
+	log.Println()
+	if pending.republishing {
+		log.Printf("REPUBLISHING:\n%v\n", c)
+	} else {
+		log.Printf("PUBLISHING:\n%v\n", c)
+	}
+	return pending, nil
+}
+
+// warnings lists the flags that make the candidate unsafe to publish
+// unless confirmed: a private bookmark might not be meant for the public,
+// and an unread one has not been vetted yet.
+func (env *Env) warnings(c *Candidate) []string {
+	var warnings []string
+	if c.Private && !env.Conf.PublishPrivate {
+		warnings = append(warnings, "private")
+	}
+	if c.ToRead && !env.Conf.PublishUnread {
+		warnings = append(warnings, "unread")
+	}
+	return warnings
+}
+
+func (pending *pendingPost) warning() string {
+	return strings.Join(pending.warnings, " and ")
+}
+
+func (pending *pendingPost) updateDestinations(conf Configuration) {
+	pending.dests, pending.republishing = nil, false
+	for _, dest := range conf.Destinations {
+		if !dest.Accepts(pending.post.Category) {
+			continue
+		}
+		if pending.state.Channels[dest.Key] != nil {
+			if !conf.RepublishAll {
+				continue
+			}
+			pending.republishing = true
+		}
+		pending.dests = append(pending.dests, dest)
+	}
+}
+
+// changeCategory moves the post into another category, which may change
+// the destinations it goes to.
+func (env *Env) changeCategory(pending *pendingPost, cat *Category) {
+	pending.post.Category = cat
+	pending.updateDestinations(env.Conf)
+}
 
-	switch env.IO.Prompt("Publish to Telegram?", 0, 'L', "Publish", "Later", "Skip permanently", "Quit") {
-	case 'P':
+func (env *Env) decide(pending *pendingPost, decision Decision) error {
+	switch decision {
+	case DecisionPublish:
 		break
-	case 'L':
+	case DecisionLater:
 		return nil
-	case 'S':
-		as.Skip = true
+	case DecisionSkip:
+		pending.state.Skip = true
+		env.State.RemoveSubmission(pending.cand.URL)
 		if err := env.saveState(); err != nil {
 			return err
 		}
+		env.tagBookmark(pending.cand, env.Conf.StatusTags.Skipped)
 		return nil
-	case 'Q':
+	case DecisionQuit:
 		return ErrQuit
 	default:
 		panic("unhandled choice")
 	}
-	err = telegram.PostText(msg, conf.Telegram)
-	if err != nil {
-		return err
+
+	if len(pending.warnings) > 0 && !pending.confirmed {
+		return fmt.Errorf("not publishing a %s bookmark without confirmation", pending.warning())
+	}
+
+	for i, dest := range pending.dests {
+		err := env.publish(pending, dest)
+		if err != nil {
+			// a retry must not repost to the destinations done already
+			pending.dests = pending.dests[i:]
+			return fmt.Errorf("%s: %w", dest.Key, err)
+		}
+
+		delete(pending.state.Partial, dest.Key)
+		pending.state.Channels[dest.Key] = &ArticleChannelState{
+			PublishTime: time.Now(),
+		}
+		if err := env.saveState(); err != nil {
+			return err
+		}
 	}
 
-	as.Channels[ChannelTelegram] = &ArticleChannelState{
-		PublishTime: time.Now(),
+	if env.State.RemoveSubmission(pending.cand.URL) {
+		if err := env.saveState(); err != nil {
+			return err
+		}
 	}
+	env.tagBookmark(pending.cand, env.Conf.StatusTags.Published)
+	return nil
+}
 
-	if err := env.saveState(); err != nil {
-		return err
+func (env *Env) publish(pending *pendingPost, dest *Destination) error {
+	post := pending.post
+	msgs := buildTelegramMessages(post, dest.ParseMode, env.Conf.Content)
+
+	chat := dest.Chat
+	if id := post.Options.Topics[dest.Key]; id != 0 {
+		chat.ThreadID = id
+	}
+
+	// resume after the messages sent by an attempt that failed midway, so
+	// that a retry doesn't repost them
+	var sent, replyTo, pinID int
+	if partial := pending.state.Partial[dest.Key]; partial != nil && partial.Sent < len(msgs) {
+		sent, replyTo, pinID = partial.Sent, partial.ReplyTo, partial.PinID
+	}
+	for i := sent; i < len(msgs); i++ {
+		msg := msgs[i]
+		msg.ReplyToMessageID = replyTo
+		id, err := env.Telegram.Send(chat, msg)
+		if err != nil {
+			if i > 0 {
+				env.recordPartial(pending.state, dest, &PartialPublish{Sent: i, ReplyTo: replyTo, PinID: pinID})
+			}
+			return err
+		}
+		// continuations of a long text reply to the previous part, but
+		// a text following a standalone photo is posted on its own
+		if text, _ := msg.Text(); text != "" {
+			if replyTo == 0 {
+				pinID = id
+			}
+			replyTo = id
+		}
 	}
 
+	if post.Options.Pin {
+		// the post is out already, so a failure to pin must not cause a repost
+		if err := env.Telegram.PinChatMessage(chat, pinID, post.Options.Silent); err != nil {
+			log.Printf("WARNING: cannot pin message %d in %v: %v", pinID, chat, err)
+		}
+	}
 	return nil
 }
 
+func (env *Env) recordPartial(as *ArticleState, dest *Destination, partial *PartialPublish) {
+	if as.Partial == nil {
+		as.Partial = make(map[string]*PartialPublish)
+	}
+	as.Partial[dest.Key] = partial
+	if err := env.saveState(); err != nil {
+		log.Printf("WARNING: cannot record the %d messages sent to %v: %v", partial.Sent, dest.Chat, err)
+	}
+}
+
+func describeDestinations(dests []*Destination) string {
+	names := make([]string, 0, len(dests))
+	for _, dest := range dests {
+		names = append(names, dest.String())
+	}
+	return strings.Join(names, ", ")
+}
+
 func (env *Env) saveState() error {
 	return WriteState(env.Conf.StateFile, env.State)
 }
@@ -0,0 +1,956 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/enrich"
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/hn"
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/httpfixture"
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/linkcheck"
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/pinboard"
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/telegram"
+)
+
+// fakePinboard serves the given posts via posts/recent, posts/all and
+// posts/get, and records the bookmarks saved via posts/add.
+type fakePinboard struct {
+	*httptest.Server
+	posts []*pinboard.Post
+
+	mut   sync.Mutex
+	added []*pinboard.Post
+}
+
+func newFakePinboard(t *testing.T, posts []*pinboard.Post) *fakePinboard {
+	fp := &fakePinboard{posts: posts}
+	fp.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		w.Header().Set("Content-Type", "text/xml")
+		switch r.URL.Path {
+		case "/v1/posts/recent":
+			fp.writePosts(w, nil)
+		case "/v1/posts/all":
+			fp.writePosts(w, func(p *pinboard.Post) bool {
+				return q.Get("tag") == "" || p.Tags.Contains(q.Get("tag"))
+			})
+		case "/v1/posts/get":
+			fp.writePosts(w, func(p *pinboard.Post) bool {
+				return p.URL == q.Get("url")
+			})
+		case "/v1/posts/add":
+			dt, _ := time.Parse(time.RFC3339, q.Get("dt"))
+			fp.mut.Lock()
+			fp.added = append(fp.added, &pinboard.Post{
+				URL:         q.Get("url"),
+				Title:       q.Get("description"),
+				Time:        dt,
+				Tags:        strings.Fields(q.Get("tags")),
+				Description: q.Get("extended"),
+				Private:     q.Get("shared") == "no",
+				ToRead:      q.Get("toread") == "yes",
+			})
+			fp.mut.Unlock()
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8" ?><result code="done" />`))
+		default:
+			t.Errorf("unexpected Pinboard request %s", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	return fp
+}
+
+func (fp *fakePinboard) writePosts(w http.ResponseWriter, filter func(p *pinboard.Post) bool) {
+	var buf strings.Builder
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8" ?><posts user="test">`)
+	for _, p := range fp.posts {
+		if filter != nil && !filter(p) {
+			continue
+		}
+		fmt.Fprintf(&buf, `<post href="%s" time="%s" description="%s" extended="%s" tag="%s" shared="%s" toread="%s" />`,
+			html.EscapeString(p.URL), p.Time.Format(time.RFC3339), html.EscapeString(p.Title),
+			html.EscapeString(p.Description), html.EscapeString(strings.Join(p.Tags, " ")),
+			yesNo(!p.Private), yesNo(p.ToRead))
+	}
+	buf.WriteString(`</posts>`)
+	w.Write([]byte(buf.String()))
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
+
+// fakeTelegram records sendMessage and pinChatMessage calls, failing them
+// all if fail is set.
+type fakeTelegram struct {
+	*httptest.Server
+	fail bool
+	// failAfter, if positive, fails the messages after that many are sent
+	failAfter int
+
+	mut    sync.Mutex
+	sent   []map[string]interface{}
+	pinned []map[string]interface{}
+}
+
+func newFakeTelegram(t *testing.T) *fakeTelegram {
+	ft := &fakeTelegram{}
+	ft.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		pin := strings.HasSuffix(r.URL.Path, "/pinChatMessage")
+		if !pin && !strings.HasSuffix(r.URL.Path, "/sendMessage") {
+			t.Errorf("unexpected Telegram request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"ok":false,"error_code":404,"description":"Not Found"}`))
+			return
+		}
+		if ft.fail || ft.failAfter > 0 && !pin && len(ft.sent) >= ft.failAfter {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`))
+			return
+		}
+
+		var params map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			t.Errorf("invalid %s body: %v", r.URL.Path, err)
+		}
+		ft.mut.Lock()
+		defer ft.mut.Unlock()
+		if pin {
+			ft.pinned = append(ft.pinned, params)
+			w.Write([]byte(`{"ok":true,"result":true}`))
+			return
+		}
+		ft.sent = append(ft.sent, params)
+		id := len(ft.sent)
+		fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d}}`, id)
+	}))
+	return ft
+}
+
+// newFakeHN serves story 1, which links to the first scenario post, and
+// finds it by URL.
+func newFakeHN(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		switch r.URL.Path {
+		case "/item/1.json":
+			w.Write([]byte(`{"id":1,"type":"story","title":"First Article on HN","url":"https://example.com/first","score":457,"descendants":312}`))
+		case "/search":
+			if r.URL.Query().Get("query") == "https://example.com/first" {
+				w.Write([]byte(`{"hits":[{"objectID":"2","title":"Other","url":"https://example.com/first-not","points":999,"num_comments":1},{"objectID":"3","title":"Dupe","url":"https://example.com/first","points":3,"num_comments":0},{"objectID":"1","title":"First Article on HN","url":"https://example.com/first","points":457,"num_comments":312}]}`))
+			} else {
+				w.Write([]byte(`{"hits":[]}`))
+			}
+		default:
+			t.Errorf("unexpected HN request %s", r.URL)
+			w.Write([]byte(`null`))
+		}
+	}))
+}
+
+// fakePages serves the pages of the scenario posts to the enrichers and
+// the link checker, with OpenGraph tags on the first one only. /short
+// redirects to /paper and /gone is missing.
+type fakePages struct{}
+
+func (fakePages) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/html"}},
+		Request:    r,
+	}
+	page := `<html><head><title>Page</title></head></html>`
+	switch r.URL.String() {
+	case "https://example.com/first":
+		page = `<html><head><meta property="og:title" content="First Article via OpenGraph"><meta property="og:site_name" content="Example"></head></html>`
+	case "https://example.com/short":
+		resp.StatusCode = http.StatusMovedPermanently
+		resp.Header.Set("Location", "https://example.com/paper?utm_source=rss")
+	case "https://example.com/gone":
+		resp.StatusCode = http.StatusNotFound
+	}
+	resp.Status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	resp.Body = ioutil.NopCloser(strings.NewReader(page))
+	return resp, nil
+}
+
+var scenarioPosts = []*pinboard.Post{
+	{
+		URL:         "https://example.com/first",
+		Title:       "First Article",
+		Time:        time.Date(2020, 11, 9, 16, 0, 0, 0, time.UTC),
+		Tags:        pinboard.TagList{"ytn", "security"},
+		Description: "Worth reading.",
+	},
+	{
+		URL:   "https://example.com/second",
+		Title: "Second Article",
+		Time:  time.Date(2020, 11, 9, 15, 0, 0, 0, time.UTC),
+		Tags:  pinboard.TagList{"ytn", "tools"},
+	},
+	{
+		URL:   "https://example.com/uncategorized",
+		Title: "No Category",
+		Time:  time.Date(2020, 11, 9, 14, 0, 0, 0, time.UTC),
+		Tags:  pinboard.TagList{"ytn"},
+	},
+	{
+		URL:   "https://example.com/unmarked",
+		Title: "Not For The Channel",
+		Time:  time.Date(2020, 11, 9, 13, 0, 0, 0, time.UTC),
+		Tags:  pinboard.TagList{"security"},
+	},
+}
+
+type scenario struct {
+	answers      []rune
+	initialState string
+	repub        bool
+	failTelegram bool
+	statusTags   bool
+	// posts default to scenarioPosts
+	posts          []*pinboard.Post
+	publishPrivate bool
+	hn             bool
+	hnDiscover     bool
+	enrich         bool
+	linkCheck      bool
+
+	wantErr     bool
+	wantPrompts int
+	wantSent    []string // titles, in order
+	wantState   map[string]string
+	// wantSaved lists the tags of the bookmarks saved to Pinboard, by URL
+	wantSaved map[string]string
+	// wantSavedDescription overrides the description expected to be saved
+	wantSavedDescription map[string]string
+	check                func(t *testing.T, tg *fakeTelegram)
+}
+
+// withFirst returns scenarioPosts with a modified copy of the first post.
+func withFirst(f func(p *pinboard.Post)) []*pinboard.Post {
+	first := *scenarioPosts[0]
+	f(&first)
+	return append([]*pinboard.Post{&first}, scenarioPosts[1:]...)
+}
+
+func makePrivate(p *pinboard.Post) {
+	p.Private = true
+}
+
+func TestRunScenarios(t *testing.T) {
+	const published = `{"published_articles":{"%s":{"url":"https://example.com/first","ch":{"tg":{"t":"2020-11-10T00:00:00Z"}}}}}`
+	firstHash := HashOfURL("https://example.com/first")
+
+	tests := map[string]scenario{
+		"publish": {
+			answers:     []rune{'P', 'P'},
+			wantPrompts: 2,
+			wantSent:    []string{"First Article", "Second Article"},
+			wantState:   map[string]string{"https://example.com/first": "tg", "https://example.com/second": "tg"},
+		},
+		"later": {
+			answers:     []rune{'L', 'L'},
+			wantPrompts: 2,
+			wantState:   map[string]string{},
+		},
+		"skip": {
+			answers:     []rune{'S', 'P'},
+			wantPrompts: 2,
+			wantSent:    []string{"Second Article"},
+			wantState:   map[string]string{"https://example.com/first": "skip", "https://example.com/second": "tg"},
+		},
+		"no category": {
+			answers:     []rune{'P'},
+			posts:       []*pinboard.Post{scenarioPosts[2]},
+			wantPrompts: 0,
+			wantState:   map[string]string{},
+		},
+		"quit": {
+			answers:     []rune{'Q'},
+			wantPrompts: 1,
+			wantState:   map[string]string{},
+		},
+		"already published": {
+			answers:      []rune{'L'},
+			initialState: fmt.Sprintf(published, firstHash),
+			wantPrompts:  1,
+			wantState:    map[string]string{"https://example.com/first": "tg (old)"},
+		},
+		"repub": {
+			answers:      []rune{'P', 'L'},
+			initialState: fmt.Sprintf(published, firstHash),
+			repub:        true,
+			wantPrompts:  2,
+			wantSent:     []string{"First Article"},
+			wantState:    map[string]string{"https://example.com/first": "tg"},
+		},
+		"status tags": {
+			answers:     []rune{'S', 'P'},
+			statusTags:  true,
+			wantPrompts: 2,
+			wantSent:    []string{"Second Article"},
+			wantState:   map[string]string{"https://example.com/first": "skip", "https://example.com/second": "tg"},
+			wantSaved: map[string]string{
+				"https://example.com/first":  "ytn security ytn-skipped",
+				"https://example.com/second": "ytn tools ytn-published",
+			},
+		},
+		"private declined": {
+			answers:     []rune{'P', 'N', 'L'},
+			posts:       withFirst(makePrivate),
+			wantPrompts: 3,
+			wantState:   map[string]string{},
+		},
+		"private confirmed": {
+			answers:     []rune{'P', 'Y', 'L'},
+			posts:       withFirst(makePrivate),
+			statusTags:  true,
+			wantPrompts: 3,
+			wantSent:    []string{"First Article"},
+			wantState:   map[string]string{"https://example.com/first": "tg"},
+			wantSaved:   map[string]string{"https://example.com/first": "ytn security ytn-published"},
+		},
+		"private allowed": {
+			answers:        []rune{'P', 'L'},
+			posts:          withFirst(makePrivate),
+			publishPrivate: true,
+			wantPrompts:    2,
+			wantSent:       []string{"First Article"},
+			wantState:      map[string]string{"https://example.com/first": "tg"},
+		},
+		"directives": {
+			answers: []rune{'P', 'L'},
+			posts: withFirst(func(p *pinboard.Post) {
+				p.Description = "Worth reading.\n\n!silent !pin\n!topic=tg:7"
+			}),
+			wantPrompts: 2,
+			wantSent:    []string{"First Article"},
+			wantState:   map[string]string{"https://example.com/first": "tg"},
+			check: func(t *testing.T, tg *fakeTelegram) {
+				if msg := tg.sent[0]; msg["disable_notification"] != true || msg["message_thread_id"] != float64(7) || strings.Contains(msg["text"].(string), "silent") {
+					t.Errorf("sent %v, wanted a silent message to topic 7 without the directives", msg)
+				}
+				if len(tg.pinned) != 1 || tg.pinned[0]["message_id"] != float64(1) {
+					t.Errorf("pinned %v, wanted message 1", tg.pinned)
+				}
+			},
+		},
+		"enrichment": {
+			answers: []rune{'P', 'L'},
+			posts: withFirst(func(p *pinboard.Post) {
+				p.Title = ""
+			}),
+			enrich:      true,
+			wantPrompts: 2,
+			wantSent:    []string{"First Article via OpenGraph"},
+			wantState:   map[string]string{"https://example.com/first": "tg"},
+		},
+		"link check": {
+			answers: []rune{'Y', 'P', 'L'},
+			posts: withFirst(func(p *pinboard.Post) {
+				p.Description = "Worth reading, see [the paper].\n\npaper: https://example.com/short\nvideo: https://example.com/gone"
+			}),
+			linkCheck:   true,
+			wantPrompts: 3,
+			wantSent:    []string{"First Article"},
+			wantState:   map[string]string{"https://example.com/first": "tg"},
+			check: func(t *testing.T, tg *fakeTelegram) {
+				if text := tg.sent[0]["text"].(string); !strings.Contains(text, `(https://example\.com/paper)`) {
+					t.Errorf("sent %q, wanted the final URL of the paper", text)
+				}
+			},
+		},
+		"hn bookmark preview": {
+			answers: []rune{'P', 'L'},
+			posts: withFirst(func(p *pinboard.Post) {
+				p.URL = "https://news.ycombinator.com/item?id=1"
+				p.Description = "Worth reading.\n\n!preview"
+			}),
+			hn:          true,
+			wantPrompts: 2,
+			wantSent:    []string{"First Article"},
+			wantState:   map[string]string{"https://news.ycombinator.com/item?id=1": "tg"},
+			check: func(t *testing.T, tg *fakeTelegram) {
+				lpo, _ := tg.sent[0]["link_preview_options"].(map[string]interface{})
+				if lpo["url"] != "https://example.com/first" {
+					t.Errorf("link_preview_options = %v, wanted the article previewed", lpo)
+				}
+			},
+		},
+		"hn lookup": {
+			answers: []rune{'P', 'L'},
+			posts: withFirst(func(p *pinboard.Post) {
+				p.Title = ""
+				p.Description = "Worth reading.\n\nhttps://news.ycombinator.com/item?id=1"
+			}),
+			hn:          true,
+			wantPrompts: 2,
+			wantSent:    []string{"First Article on HN"},
+			wantState:   map[string]string{"https://example.com/first": "tg"},
+			check: func(t *testing.T, tg *fakeTelegram) {
+				if text := tg.sent[0]["text"].(string); !strings.Contains(text, `HN \(312 comments\)`) {
+					t.Errorf("sent %q, wanted the HN comment count", text)
+				}
+			},
+		},
+		"hn discovery": {
+			answers:     []rune{'Y', 'P', 'L'},
+			hnDiscover:  true,
+			wantPrompts: 3,
+			wantSent:    []string{"First Article"},
+			wantState:   map[string]string{"https://example.com/first": "tg"},
+			wantSaved:   map[string]string{"https://example.com/first": "ytn security"},
+			wantSavedDescription: map[string]string{
+				"https://example.com/first": "Worth reading.\n\nhttps://news.ycombinator.com/item?id=1",
+			},
+			check: func(t *testing.T, tg *fakeTelegram) {
+				if text := tg.sent[0]["text"].(string); !strings.Contains(text, `[HN](https://news\.ycombinator\.com/item?id\=1)`) {
+					t.Errorf("sent %q, wanted the discovered HN link", text)
+				}
+			},
+		},
+		"hn discovery declined": {
+			answers:     []rune{'N', 'P', 'L'},
+			hnDiscover:  true,
+			wantPrompts: 3,
+			wantSent:    []string{"First Article"},
+			wantState:   map[string]string{"https://example.com/first": "tg"},
+		},
+		"unknown directive": {
+			answers: []rune{'L'},
+			posts: withFirst(func(p *pinboard.Post) {
+				p.Description = "Worth reading.\n\n!loud"
+			}),
+			wantPrompts: 1,
+			wantState:   map[string]string{},
+		},
+		"unknown topic destination": {
+			answers: []rune{'L'},
+			posts: withFirst(func(p *pinboard.Post) {
+				p.Description = "Worth reading.\n\n!topic=security:7"
+			}),
+			wantPrompts: 1,
+			wantState:   map[string]string{},
+		},
+		"exclamation ending the only paragraph": {
+			answers: []rune{'P', 'L'},
+			posts: withFirst(func(p *pinboard.Post) {
+				p.Description = "Worth reading.\n!wow"
+			}),
+			wantPrompts: 2,
+			wantSent:    []string{"First Article"},
+			wantState:   map[string]string{"https://example.com/first": "tg"},
+		},
+		"telegram failure": {
+			answers:      []rune{'P'},
+			failTelegram: true,
+			wantErr:      true,
+			wantPrompts:  1,
+			wantState:    map[string]string{},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			test.run(t)
+		})
+	}
+}
+
+func (test scenario) run(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ytn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	stateFile := filepath.Join(dir, "state.json")
+	initialState := test.initialState
+	if initialState == "" {
+		initialState = "{}"
+	}
+	if err := ioutil.WriteFile(stateFile, []byte(initialState), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	posts := test.posts
+	if posts == nil {
+		posts = scenarioPosts
+	}
+	pb := newFakePinboard(t, posts)
+	defer pb.Close()
+	tg := newFakeTelegram(t)
+	tg.fail = test.failTelegram
+	defer tg.Close()
+	hs := newFakeHN(t)
+	defer hs.Close()
+
+	conf := Configuration{
+		Pinboard: pinboard.Options{
+			BaseURL: pb.URL + "/v1",
+		},
+		Telegram: telegram.Options{
+			Credentials: telegram.Credentials{BotToken: "123:TEST"},
+		},
+		Destinations: []*Destination{
+			{Key: ChannelTelegram, Chat: telegram.Chat{ID: "@chan"}, ParseMode: telegram.ParseModeMarkdownV2},
+		},
+		Content: ContentOptions{
+			MarkerTag:    "ytn",
+			StickyLinks:  []string{"HN"},
+			LongMessages: LongMessageTruncate,
+			Categories: []*Category{
+				{Tags: []string{"security"}, Title: "Security"},
+				{Tags: []string{"tools"}, Title: "Tools"},
+			},
+		},
+		StateFile:      stateFile,
+		RepublishAll:   test.repub,
+		PublishPrivate: test.publishPrivate,
+		HN: HNOptions{
+			Options:       hn.Options{BaseURL: hs.URL, SearchBaseURL: hs.URL},
+			Lookup:        test.hn,
+			Discover:      test.hnDiscover,
+			CommentCounts: true,
+		},
+		Enrich: EnrichOptions{
+			Options: enrich.Options{Transport: fakePages{}},
+			Enabled: test.enrich,
+		},
+		LinkCheck: LinkCheckOptions{
+			Options: linkcheck.Options{Transport: fakePages{}},
+			Enabled: test.linkCheck,
+		},
+	}
+	if test.statusTags {
+		conf.StatusTags = StatusTagOptions{Published: "ytn-published", Skipped: "ytn-skipped"}
+	}
+
+	env, err := newEnv(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sio := &ScriptedIO{Answers: test.answers}
+	env.IO = sio
+	env.Telegram.BaseURL = tg.URL
+	env.Telegram.Backoff = 0
+	env.Pinboard.Interval = 0
+
+	err = env.Run()
+	if test.wantErr && err == nil {
+		t.Errorf("Run succeeded, wanted an error")
+	} else if !test.wantErr && err != nil {
+		t.Errorf("Run failed: %v", err)
+	}
+
+	if len(sio.Prompts) != test.wantPrompts {
+		t.Errorf("prompted %d times, wanted %d", len(sio.Prompts), test.wantPrompts)
+	}
+
+	var sent []string
+	for _, params := range tg.sent {
+		if params["chat_id"] != "@chan" {
+			t.Errorf("sent to chat %v, wanted @chan", params["chat_id"])
+		}
+		text, _ := params["text"].(string)
+		sent = append(sent, strings.SplitN(text, "\n", 2)[0])
+	}
+	for i, title := range test.wantSent {
+		if i >= len(sent) || !strings.Contains(sent[i], title) {
+			t.Errorf("sent messages starting with %q, wanted %q", sent, test.wantSent)
+			break
+		}
+	}
+	if len(sent) != len(test.wantSent) {
+		t.Errorf("sent %d messages, wanted %d", len(sent), len(test.wantSent))
+	}
+	if test.check != nil && !t.Failed() {
+		test.check(t, tg)
+	}
+
+	if actual := summarizeStateFile(t, stateFile); !reflect.DeepEqual(actual, test.wantState) {
+		t.Errorf("state = %v, wanted %v", actual, test.wantState)
+	}
+
+	saved := make(map[string]string)
+	for _, p := range pb.added {
+		saved[p.URL] = strings.Join(p.Tags, " ")
+		orig := findPost(posts, p.URL)
+		if orig == nil {
+			t.Errorf("saved unknown bookmark %+v", p)
+			continue
+		}
+		desc, ok := test.wantSavedDescription[p.URL]
+		if !ok {
+			desc = orig.Description
+		}
+		if p.Title != orig.Title || !p.Time.Equal(orig.Time) || p.Description != desc || p.Private != orig.Private {
+			t.Errorf("saved bookmark %+v does not keep the fields of %+v", p, orig)
+		}
+	}
+	if len(saved) > 0 || len(test.wantSaved) > 0 {
+		if !reflect.DeepEqual(saved, test.wantSaved) {
+			t.Errorf("saved to Pinboard %v, wanted %v", saved, test.wantSaved)
+		}
+	}
+}
+
+func findPost(posts []*pinboard.Post, url string) *pinboard.Post {
+	for _, p := range posts {
+		if p.URL == url {
+			return p
+		}
+	}
+	return nil
+}
+
+// summarizeStateFile maps the URLs in the state file to "skip" or a list of
+// the destinations they were published to, marking the records that still
+// have the publish time of the initial state as old.
+func summarizeStateFile(t *testing.T, fn string) map[string]string {
+	state, err := ReadState(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(map[string]string)
+	for hash, as := range state.PublishedArticles {
+		if hash != HashOfURL(as.URL) {
+			t.Errorf("state key %s does not match %s", hash, as.URL)
+		}
+		if as.Skip {
+			result[as.URL] = "skip"
+			continue
+		}
+		var keys []string
+		for key, cs := range as.Channels {
+			if cs.PublishTime.Equal(time.Date(2020, 11, 10, 0, 0, 0, 0, time.UTC)) {
+				key += " (old)"
+			}
+			keys = append(keys, key)
+		}
+		if len(keys) > 0 {
+			sort.Strings(keys)
+			result[as.URL] = strings.Join(keys, ",")
+		}
+	}
+	return result
+}
+
+func TestRebuildState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ytn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	posts := []*pinboard.Post{
+		{URL: "https://example.com/first", Title: "First Article", Time: time.Date(2020, 11, 10, 0, 0, 0, 0, time.UTC), Tags: []string{"ytn", "security", "ytn-published"}},
+		{URL: "https://example.com/second", Title: "Second Article", Time: time.Date(2020, 11, 12, 0, 0, 0, 0, time.UTC), Tags: []string{"ytn", "tools", "ytn-skipped"}},
+		{URL: "https://example.com/third", Title: "Third Article", Time: time.Date(2020, 11, 13, 0, 0, 0, 0, time.UTC), Tags: []string{"ytn", "tools"}},
+	}
+	pb := newFakePinboard(t, posts)
+	defer pb.Close()
+
+	stateFile := filepath.Join(dir, "state.json")
+	if err := ioutil.WriteFile(stateFile, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf := Configuration{
+		Pinboard: pinboard.Options{
+			BaseURL: pb.URL + "/v1",
+		},
+		Destinations: []*Destination{
+			{Key: ChannelTelegram, Chat: telegram.Chat{ID: "@chan"}},
+		},
+		Content: ContentOptions{
+			MarkerTag: "ytn",
+			SkipTags:  []string{"ytn-published", "ytn-skipped"},
+		},
+		StatusTags: StatusTagOptions{Published: "ytn-published", Skipped: "ytn-skipped"},
+		StateFile:  stateFile,
+	}
+	env, err := newEnv(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Pinboard.Interval = 0
+
+	if err := env.rebuildState(); err != nil {
+		t.Fatal(err)
+	}
+	wanted := map[string]string{"https://example.com/first": "tg (old)", "https://example.com/second": "skip"}
+	if actual := summarizeStateFile(t, stateFile); !reflect.DeepEqual(actual, wanted) {
+		t.Errorf("state = %v, wanted %v", actual, wanted)
+	}
+}
+
+func TestPublishResumesSplitPost(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ytn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	tg := newFakeTelegram(t)
+	defer tg.Close()
+	tg.failAfter = 1
+
+	stateFile := filepath.Join(dir, "state.json")
+	if err := ioutil.WriteFile(stateFile, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf := Configuration{
+		Telegram: telegram.Options{
+			Credentials: telegram.Credentials{BotToken: "123:TEST"},
+		},
+		Destinations: []*Destination{
+			{Key: ChannelTelegram, Chat: telegram.Chat{ID: "@chan"}, ParseMode: telegram.ParseModeMarkdownV2},
+		},
+		Content: ContentOptions{
+			MarkerTag:    "ytn",
+			LongMessages: LongMessageSplit,
+			Categories:   []*Category{{Tags: []string{"tools"}, Title: "Tools"}},
+		},
+		StateFile: stateFile,
+	}
+	env, err := newEnv(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Telegram.BaseURL = tg.URL
+	env.Telegram.Backoff = 0
+
+	para := strings.Repeat("word ", 600)
+	pending, err := env.prepare(&Candidate{
+		URL:         "https://example.com/long",
+		Title:       "Long Article",
+		Tags:        []string{"ytn", "tools"},
+		Description: para + "\n\n" + para + "\n\n" + para,
+	})
+	if err != nil || pending == nil {
+		t.Fatalf("prepare = %v, %v", pending, err)
+	}
+
+	if err := env.decide(pending, DecisionPublish); err == nil {
+		t.Fatalf("decide succeeded, wanted an error")
+	}
+	if p := pending.state.Partial[ChannelTelegram]; p == nil || p.Sent != 1 {
+		t.Fatalf("partial = %+v, wanted 1 message sent", p)
+	}
+
+	tg.failAfter = 0
+	if err := env.decide(pending, DecisionPublish); err != nil {
+		t.Fatal(err)
+	}
+	if len(tg.sent) != 3 {
+		t.Errorf("sent %d messages, wanted 3", len(tg.sent))
+	}
+	for i, params := range tg.sent[1:] {
+		if reply := params["reply_to_message_id"]; reply != float64(i+1) {
+			t.Errorf("message %d replies to %v, wanted %d", i+2, reply, i+1)
+		}
+	}
+	if actual := summarizeStateFile(t, stateFile); actual["https://example.com/long"] != "tg" {
+		t.Errorf("state = %v, wanted the post published", actual)
+	}
+	if pending.state.Partial[ChannelTelegram] != nil {
+		t.Errorf("partial = %+v, wanted it cleared", pending.state.Partial[ChannelTelegram])
+	}
+}
+
+func TestDecideSkipsDestinationsDoneBeforeFailure(t *testing.T) {
+	tg := newFakeTelegram(t)
+	defer tg.Close()
+	tg.failAfter = 1
+
+	env := newDecideTestEnv(t, tg, true,
+		&Destination{Key: ChannelTelegram, Chat: telegram.Chat{ID: "@chan"}, ParseMode: telegram.ParseModeMarkdownV2},
+		&Destination{Key: "group", Chat: telegram.Chat{ID: "-100123"}, ParseMode: telegram.ParseModeMarkdownV2},
+	)
+	pending, err := env.prepare(&Candidate{
+		URL:   "https://example.com/tool",
+		Title: "Tool",
+		Tags:  []string{"ytn", "tools"},
+	})
+	if err != nil || pending == nil {
+		t.Fatalf("prepare = %v, %v", pending, err)
+	}
+
+	if err := env.decide(pending, DecisionPublish); err == nil {
+		t.Fatalf("decide succeeded, wanted an error")
+	}
+	tg.failAfter = 0
+	if err := env.decide(pending, DecisionPublish); err != nil {
+		t.Fatal(err)
+	}
+	var chats []interface{}
+	for _, params := range tg.sent {
+		chats = append(chats, params["chat_id"])
+	}
+	if len(chats) != 2 || chats[0] != "@chan" || chats[1] != "-100123" {
+		t.Errorf("sent to %v, wanted [@chan -100123]", chats)
+	}
+}
+
+func TestDecideRemovesSubmissions(t *testing.T) {
+	tg := newFakeTelegram(t)
+	defer tg.Close()
+
+	env := newDecideTestEnv(t, tg, false,
+		&Destination{Key: ChannelTelegram, Chat: telegram.Chat{ID: "@chan"}, ParseMode: telegram.ParseModeMarkdownV2},
+	)
+	for _, u := range []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"} {
+		env.State.Submissions = append(env.State.Submissions, &Submission{URL: u, Tags: []string{"ytn", "tools"}})
+	}
+
+	for _, decision := range []Decision{DecisionLater, DecisionSkip, DecisionPublish} {
+		pending, err := env.prepare(env.State.Submissions[0].Candidate())
+		if err != nil || pending == nil {
+			t.Fatalf("prepare = %v, %v", pending, err)
+		}
+		if err := env.decide(pending, decision); err != nil {
+			t.Fatal(err)
+		}
+		if decision == DecisionLater {
+			// decided later, so goes to the end of the queue
+			env.State.Submissions = append(env.State.Submissions[1:], env.State.Submissions[0])
+		}
+	}
+
+	state, err := ReadState(env.Conf.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Submissions) != 1 || state.Submissions[0].URL != "https://example.com/a" {
+		t.Errorf("submissions = %v, wanted only the one decided later", state.Submissions)
+	}
+}
+
+func newDecideTestEnv(t *testing.T, tg *fakeTelegram, republish bool, dests ...*Destination) *Env {
+	dir, err := ioutil.TempDir("", "ytn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	log.SetOutput(ioutil.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	stateFile := filepath.Join(dir, "state.json")
+	if err := ioutil.WriteFile(stateFile, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf := Configuration{
+		Telegram: telegram.Options{
+			Credentials: telegram.Credentials{BotToken: "123:TEST"},
+		},
+		Destinations: dests,
+		Content: ContentOptions{
+			MarkerTag:  "ytn",
+			Categories: []*Category{{Tags: []string{"tools"}, Title: "Tools"}},
+		},
+		StateFile:    stateFile,
+		RepublishAll: republish,
+	}
+	env, err := newEnv(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Telegram.BaseURL = tg.URL
+	return env
+}
+
+// TestRunReplaysFixtures runs a review against the exchanges recorded in
+// testdata/fixtures/publish: the first post gets a 502 that is retried,
+// the second one a 400 that stops the run.
+func TestRunReplaysFixtures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ytn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	fixtures, err := httpfixture.New(httpfixture.ModeReplay, "testdata/fixtures/publish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := fixtureConf(dir, fixtures)
+	env, err := newEnv(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sio := &ScriptedIO{Answers: []rune{'P', 'P'}}
+	env.IO = sio
+	env.Telegram.Backoff = 0
+	env.Pinboard.Interval = 0
+
+	err = env.Run()
+	if err == nil || !strings.Contains(err.Error(), "chat not found") {
+		t.Errorf("Run = %v, wanted the chat not found error", err)
+	}
+	if len(sio.Prompts) != 2 {
+		t.Errorf("prompts = %q, wanted 2", sio.Prompts)
+	}
+	actual := summarizeStateFile(t, conf.StateFile)
+	expected := map[string]string{"https://example.com/first": "tg"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("state = %v, wanted %v", actual, expected)
+	}
+}
+
+func fixtureConf(dir string, transport http.RoundTripper) Configuration {
+	stateFile := filepath.Join(dir, "state.json")
+	ioutil.WriteFile(stateFile, []byte("{}"), 0644)
+	return Configuration{
+		Pinboard: pinboard.Options{
+			Credentials: pinboard.Credentials{APIToken: "test:SECRET"},
+			Transport:   transport,
+		},
+		Telegram: telegram.Options{
+			Credentials: telegram.Credentials{BotToken: "123:SECRET"},
+			Transport:   transport,
+		},
+		Destinations: []*Destination{
+			{Key: ChannelTelegram, Chat: telegram.Chat{ID: "@chan"}, ParseMode: telegram.ParseModeMarkdownV2},
+		},
+		Content: ContentOptions{
+			MarkerTag:    "ytn",
+			LongMessages: LongMessageTruncate,
+			Categories: []*Category{
+				{Tags: []string{"security"}, Title: "Security"},
+				{Tags: []string{"tools"}, Title: "Tools"},
+			},
+		},
+		StateFile: stateFile,
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/telegram"
+)
+
+// Destination is a Telegram chat that posts are published to. Each
+// destination keeps its own publish record in the state under Key.
+type Destination struct {
+	Key       string
+	Chat      telegram.Chat
+	ParseMode telegram.ParseMode
+	// CategoryTags limits the destination to posts in categories having
+	// any of these tags; empty means all categories.
+	CategoryTags []string
+}
+
+func (dest *Destination) String() string {
+	return fmt.Sprintf("%s (%v)", dest.Key, dest.Chat)
+}
+
+func (dest *Destination) Accepts(cat *Category) bool {
+	if len(dest.CategoryTags) == 0 {
+		return true
+	}
+	return cat != nil && cat.CoversAnyTagIn(makeTagSet(dest.CategoryTags))
+}
+
+// parseDestinations parses a list of extra destinations like
+// "security=-1001234567890/42:security#HTML; fun=@funchan:fun,kids", where
+// the part after the colon lists category tags and the part after the hash
+// overrides the default parse mode.
+func parseDestinations(s string, defaultMode telegram.ParseMode) ([]*Destination, error) {
+	var result []*Destination
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(s, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		eq := strings.IndexByte(item, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("invalid destination %q, expected key=chat[:tags][#mode]", item)
+		}
+		key, spec := item[:eq], item[eq+1:]
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate destination %s", key)
+		}
+		seen[key] = true
+
+		parseMode := defaultMode
+		if hash := strings.IndexByte(spec, '#'); hash >= 0 {
+			mode, err := telegram.ParseParseMode(spec[hash+1:])
+			if err != nil {
+				return nil, fmt.Errorf("destination %s: %w", key, err)
+			}
+			parseMode, spec = mode, spec[:hash]
+		}
+
+		var tags []string
+		if colon := strings.IndexByte(spec, ':'); colon >= 0 {
+			tags = strings.Split(spec[colon+1:], ",")
+			spec = spec[:colon]
+		}
+
+		chat, err := telegram.ParseChat(spec)
+		if err != nil {
+			return nil, fmt.Errorf("destination %s: %w", key, err)
+		}
+
+		result = append(result, &Destination{
+			Key:          key,
+			Chat:         chat,
+			ParseMode:    parseMode,
+			CategoryTags: tags,
+		})
+	}
+	return result, nil
+}
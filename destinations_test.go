@@ -0,0 +1,28 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/telegram"
+)
+
+func TestParseDestinations(t *testing.T) {
+	dests, err := parseDestinations("security=-1001234567890/42:security#HTML; fun=@funchan:fun,kids", telegram.ParseModeMarkdownV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*Destination{
+		{Key: "security", Chat: telegram.Chat{ID: "-1001234567890", ThreadID: 42}, ParseMode: telegram.ParseModeHTML, CategoryTags: []string{"security"}},
+		{Key: "fun", Chat: telegram.Chat{ID: "@funchan"}, ParseMode: telegram.ParseModeMarkdownV2, CategoryTags: []string{"fun", "kids"}},
+	}
+	if !reflect.DeepEqual(dests, expected) {
+		t.Errorf("parseDestinations = %+v, wanted %+v", dests, expected)
+	}
+
+	for _, s := range []string{"chan", "a=@a; a=@b", "a=@a#Markdown1"} {
+		if _, err := parseDestinations(s, telegram.ParseModeMarkdownV2); err == nil {
+			t.Errorf("parseDestinations(%q) succeeded, wanted an error", s)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PostOptions are per-post publishing options set by a directive line at
+// the end of the description, like "!silent !pin !category=tools".
+type PostOptions struct {
+	// Silent sends the messages without a notification.
+	Silent bool
+	// Preview enables the link preview, like the preview tag.
+	Preview bool
+	// Pin pins the (first) message in every destination chat.
+	Pin bool
+	// NoHN drops the HN link.
+	NoHN bool
+	// Category is a tag of the category to use regardless of the post tags.
+	Category string
+	// Topics are the forum topic (message thread) IDs to publish to instead
+	// of the ones configured, by destination key.
+	Topics map[string]int
+}
+
+var directiveRe = regexp.MustCompile(`^!([a-z]+)(?:=(\S+))?$`)
+
+// isDirectiveLine tells whether every word of the line looks like
+// a directive, so that lines merely starting with "!" are left alone.
+func isDirectiveLine(line string) bool {
+	fields := strings.Fields(line)
+	for _, f := range fields {
+		if !directiveRe.MatchString(f) {
+			return false
+		}
+	}
+	return len(fields) > 0
+}
+
+func parseDirectives(directives []string) (PostOptions, error) {
+	var opt PostOptions
+	for _, d := range directives {
+		m := directiveRe.FindStringSubmatch(d)
+		if m == nil {
+			return opt, fmt.Errorf("invalid directive %q", d)
+		}
+		name, value := m[1], m[2]
+
+		var flag *bool
+		switch name {
+		case "silent":
+			flag = &opt.Silent
+		case "preview":
+			flag = &opt.Preview
+		case "pin":
+			flag = &opt.Pin
+		case "nohn":
+			flag = &opt.NoHN
+		case "category":
+			if value == "" {
+				return opt, fmt.Errorf("directive %s needs a category tag, like !category=tools", d)
+			}
+			opt.Category = value
+			continue
+		case "topic":
+			colon := strings.IndexByte(value, ':')
+			if colon <= 0 {
+				return opt, fmt.Errorf("directive %s needs a destination and a topic ID, like !topic=security:42", d)
+			}
+			id, err := strconv.Atoi(value[colon+1:])
+			if err != nil || id <= 0 {
+				return opt, fmt.Errorf("directive %s needs a numeric topic ID, like !topic=security:42", d)
+			}
+			if opt.Topics == nil {
+				opt.Topics = make(map[string]int)
+			}
+			opt.Topics[value[:colon]] = id
+			continue
+		default:
+			return opt, fmt.Errorf("unknown directive %s, expected !silent, !preview, !pin, !nohn, !category=TAG or !topic=DEST:ID", d)
+		}
+		if value != "" {
+			return opt, fmt.Errorf("directive !%s does not take a value", name)
+		}
+		*flag = true
+	}
+	return opt, nil
+}
+
+func (opt PostOptions) String() string {
+	var items []string
+	if opt.Silent {
+		items = append(items, "silent")
+	}
+	if opt.Preview {
+		items = append(items, "preview")
+	}
+	if opt.Pin {
+		items = append(items, "pin")
+	}
+	if opt.NoHN {
+		items = append(items, "no HN link")
+	}
+	if opt.Category != "" {
+		items = append(items, "category "+opt.Category)
+	}
+	keys := make([]string, 0, len(opt.Topics))
+	for key := range opt.Topics {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		items = append(items, "topic "+key+":"+strconv.Itoa(opt.Topics[key]))
+	}
+	return strings.Join(items, ", ")
+}
+
+// checkTopics verifies that the topics are set for known destinations,
+// so that a typo doesn't send the post to the default topic.
+func checkTopics(opt PostOptions, dests []*Destination) error {
+	for key := range opt.Topics {
+		found := false
+		for _, dest := range dests {
+			if dest.Key == key {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("directive !topic=%s:%d: no such destination", key, opt.Topics[key])
+		}
+	}
+	return nil
+}
+
+// categoryByTag returns the category having the given tag.
+func categoryByTag(categories []*Category, tag string) *Category {
+	for _, cat := range categories {
+		for _, t := range cat.Tags {
+			if t == tag {
+				return cat
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePostDirectives(t *testing.T) {
+	opt := ContentOptions{
+		MarkerTag:   "ytn",
+		StickyLinks: []string{"HN"},
+		Categories: []*Category{
+			{Tags: []string{"security"}, Title: "Security"},
+			{Tags: []string{"tools"}, Title: "Tools"},
+		},
+	}
+	tests := []struct {
+		Description string
+		Options     PostOptions
+		Category    string
+		Links       int
+		Preview     bool
+	}{
+		{"Text.\n\nhttps://news.ycombinator.com/item?id=1", PostOptions{}, "Security", 1, false},
+		{"Text.\n\nhttps://news.ycombinator.com/item?id=1\n!nohn !preview", PostOptions{NoHN: true, Preview: true}, "Security", 0, true},
+		{"Text.\n\n!category=tools\nhttps://news.ycombinator.com/item?id=1\n!silent", PostOptions{Category: "tools", Silent: true}, "Tools", 1, false},
+		{"!pin", PostOptions{Pin: true}, "Security", 0, false},
+		{"Text.\n!important stuff", PostOptions{}, "Security", 0, false},
+		{"Text.\n!wow", PostOptions{}, "Security", 0, false},
+		{"Text.\n\n!topic=security:42 !topic=tg:7", PostOptions{Topics: map[string]int{"security": 42, "tg": 7}}, "Security", 0, false},
+	}
+	for _, test := range tests {
+		c := &Candidate{URL: "https://example.com/", Tags: []string{"ytn", "security"}, Description: test.Description}
+		post, err := parsePost(c, opt)
+		if err != nil {
+			t.Errorf("parsePost(%q) failed: %v", test.Description, err)
+			continue
+		}
+		if !reflect.DeepEqual(post.Options, test.Options) {
+			t.Errorf("parsePost(%q).Options = %+v, wanted %+v", test.Description, post.Options, test.Options)
+		}
+		if post.Category.Title != test.Category {
+			t.Errorf("parsePost(%q).Category = %q, wanted %q", test.Description, post.Category.Title, test.Category)
+		}
+		if len(post.StickyLinks) != test.Links {
+			t.Errorf("parsePost(%q).StickyLinks = %v, wanted %d", test.Description, post.StickyLinks, test.Links)
+		}
+		if (post.Preview != nil) != test.Preview {
+			t.Errorf("parsePost(%q).Preview = %v, wanted preview %v", test.Description, post.Preview, test.Preview)
+		}
+	}
+
+	for _, desc := range []string{"Text.\n\n!loud", "Text.\n\n!pin=1", "Text.\n\n!topic=general", "Text.\n\n!topic=42", "Text.\n\n!topic=security:x", "Text.\n\n!category=fun"} {
+		c := &Candidate{URL: "https://example.com/", Tags: []string{"ytn", "security"}, Description: desc}
+		if _, err := parsePost(c, opt); err == nil {
+			t.Errorf("parsePost(%q) succeeded, wanted an error", desc)
+		}
+	}
+}
+
+func TestCheckTopics(t *testing.T) {
+	dests := []*Destination{{Key: "tg"}, {Key: "security"}}
+	tests := []struct {
+		Topics map[string]int
+		Valid  bool
+	}{
+		{nil, true},
+		{map[string]int{"security": 42}, true},
+		{map[string]int{"tg": 1, "security": 42}, true},
+		{map[string]int{"secuirty": 42}, false},
+	}
+	for _, test := range tests {
+		err := checkTopics(PostOptions{Topics: test.Topics}, dests)
+		if valid := err == nil; valid != test.Valid {
+			t.Errorf("checkTopics(%v) = %v, wanted valid = %v", test.Topics, err, test.Valid)
+		}
+	}
+}
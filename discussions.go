@@ -0,0 +1,47 @@
+package main
+
+import (
+	"regexp"
+)
+
+// DiscussionSite recognizes the links to discussions of a post on some site,
+// so that a bare trailing URL gets a link key without a "key: url" prefix.
+// Like any link key, Key can be listed in ContentOptions.StickyLinks.
+type DiscussionSite struct {
+	Key string
+	// Label and Emoji are used for link buttons unless overridden via
+	// ContentOptions.LinkLabels.
+	Label string
+	Emoji string
+	re    *regexp.Regexp
+}
+
+var discussionSites = []*DiscussionSite{
+	{Key: LinkNameHN, Label: "HN discussion", Emoji: "💬", re: hckrnewsRe},
+	{Key: "Lobsters", Label: "Lobsters", Emoji: "🦞", re: regexp.MustCompile(`^https://lobste\.rs/s/[a-z0-9]+(/\S*)?$`)},
+	{Key: "Reddit", Label: "Reddit", Emoji: "👽", re: regexp.MustCompile(`^https://((www|old|new)\.)?reddit\.com/r/\w+/comments/\w+(/\S*)?$`)},
+	{Key: "Tildes", Label: "Tildes", Emoji: "〰️", re: regexp.MustCompile(`^https://tildes\.net/~[\w.]+/\w+(/\S*)?$`)},
+	{Key: "Slashdot", Label: "Slashdot", Emoji: "📰", re: regexp.MustCompile(`^https?://([\w-]+\.)?slashdot\.org/story/\S+$`)},
+	{Key: "GitHub_issue", Label: "GitHub issue", Emoji: "🐙", re: regexp.MustCompile(`^https://github\.com/[\w.-]+/[\w.-]+/issues/\d+([/?#]\S*)?$`)},
+	{Key: "GitHub_discussion", Label: "GitHub discussion", Emoji: "🐙", re: regexp.MustCompile(`^https://github\.com/[\w.-]+/[\w.-]+/discussions/\d+([/?#]\S*)?$`)},
+	{Key: "YouTube", Label: "YouTube", Emoji: "▶️", re: regexp.MustCompile(`^https://((www|m)\.youtube\.com/watch\?\S*v=|youtu\.be/)[\w-]+\S*$`)},
+}
+
+// recognizeDiscussion returns the site the URL is a discussion on, if any.
+func recognizeDiscussion(u string) *DiscussionSite {
+	for _, site := range discussionSites {
+		if site.re.MatchString(u) {
+			return site
+		}
+	}
+	return nil
+}
+
+func discussionSiteByKey(key string) *DiscussionSite {
+	for _, site := range discussionSites {
+		if site.Key == key {
+			return site
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecognizeDiscussion(t *testing.T) {
+	tests := []struct {
+		URL string
+		Key string
+	}{
+		{"https://news.ycombinator.com/item?id=25025552", "HN"},
+		{"https://lobste.rs/s/abc123/some_story", "Lobsters"},
+		{"https://lobste.rs/s/abc123", "Lobsters"},
+		{"https://www.reddit.com/r/golang/comments/k1x2y3/some_title/", "Reddit"},
+		{"https://old.reddit.com/r/programming/comments/k1x2y3", "Reddit"},
+		{"https://tildes.net/~comp/12ab/some_title", "Tildes"},
+		{"https://tech.slashdot.org/story/20/11/09/1234567/some-title", "Slashdot"},
+		{"https://github.com/golang/go/issues/42", "GitHub_issue"},
+		{"https://github.com/golang/go/discussions/43#discussioncomment-1", "GitHub_discussion"},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "YouTube"},
+		{"https://youtu.be/dQw4w9WgXcQ?t=42", "YouTube"},
+		{"https://github.com/golang/go", ""},
+		{"https://www.reddit.com/r/golang/", ""},
+		{"https://example.com/lobste.rs/s/abc123", ""},
+	}
+	for _, test := range tests {
+		var actual string
+		if site := recognizeDiscussion(test.URL); site != nil {
+			actual = site.Key
+		}
+		if actual != test.Key {
+			t.Errorf("recognizeDiscussion(%q) = %q, wanted %q", test.URL, actual, test.Key)
+		}
+	}
+}
+
+func TestParsePostDiscussionLinks(t *testing.T) {
+	opt := ContentOptions{
+		StickyLinks:       []string{"HN", "Lobsters"},
+		StickyLinkButtons: true,
+		LinkLabels:        map[string]LinkLabel{"HN": {Label: "Comments"}},
+	}
+	c := &Candidate{
+		URL:         "https://example.com/",
+		Description: "Text.\n\nhttps://lobste.rs/s/abc123\nhttps://news.ycombinator.com/item?id=1\nhttps://www.reddit.com/r/golang/comments/k1x2y3",
+	}
+	post, err := parsePost(c, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(post.Description) != 1 {
+		t.Errorf("description = %v, wanted just the text", post.Description)
+	}
+	if post.Links["Reddit"] == "" {
+		t.Errorf("links = %v, wanted a Reddit link", post.Links)
+	}
+
+	var labels []string
+	for _, row := range buildLinkButtons(post.LinkButtons, opt.LinkLabels) {
+		for _, b := range row {
+			labels = append(labels, b.Text)
+		}
+	}
+	if expected := []string{"Comments", "🦞 Lobsters"}; !reflect.DeepEqual(labels, expected) {
+		t.Errorf("buttons = %q, wanted %q", labels, expected)
+	}
+}
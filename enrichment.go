@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log"
+
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/enrich"
+)
+
+// EnrichOptions configure fetching metadata about the post URLs from the
+// sites they point to, like the stars of a GitHub repository.
+type EnrichOptions struct {
+	enrich.Options
+	Enabled bool
+}
+
+// enrich sets the metadata of the post, filling in a missing title and
+// adding the PDF link of a paper. Failures are only logged: the post can be
+// published without it.
+func (env *Env) enrich(post *Post) {
+	if !env.Conf.Enrich.Enabled {
+		return
+	}
+	meta, err := env.Enrich.Enrich(post.URL)
+	if err != nil {
+		log.Printf("[enrich] WARNING: %v", err)
+		return
+	}
+	if meta == nil {
+		return
+	}
+	post.Meta = meta
+
+	if post.Title == "" {
+		post.Title = meta.Title
+	}
+	if meta.PDFURL != "" && meta.PDFURL != post.URL && post.Links[LinkNamePDF] == "" {
+		post.Links[LinkNamePDF] = meta.PDFURL
+		for _, key := range env.Conf.Content.StickyLinks {
+			if key == LinkNamePDF {
+				post.addStickyLink(Link{Key: LinkNamePDF, URL: meta.PDFURL}, env.Conf.Content)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/pinboard"
+)
+
+var update = flag.Bool("update", false, "update .golden files")
+
+const goldenDir = "testdata/golden"
+
+var goldenSlugRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// TestGoldenMarkdown renders every mock bookmark and compares the result
+// with testdata/golden; run with -update to accept the changes.
+func TestGoldenMarkdown(t *testing.T) {
+	raw, err := ioutil.ReadFile("_mockdata/pinboard.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	posts, err := pinboard.ParseExport(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *update {
+		os.RemoveAll(goldenDir)
+		if err := os.MkdirAll(goldenDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opt := defaultContentOptions()
+	expectedFiles := make(map[string]bool)
+	for i, pp := range posts {
+		slug := strings.Trim(goldenSlugRe.ReplaceAllString(strings.ToLower(CanonicalURL(pp.URL)), "-"), "-")
+		if len(slug) > 50 {
+			slug = slug[:50]
+		}
+		name := fmt.Sprintf("%02d-%s.golden", i+1, slug)
+		fn := filepath.Join(goldenDir, name)
+		expectedFiles[name] = true
+
+		post, err := parsePost(pinboardCandidate(pp, SourcePinboard), opt)
+		if err != nil {
+			t.Errorf("%s: parsePost failed: %v", pp.URL, err)
+			continue
+		}
+		actual := buildTelegramMarkdown(post)
+
+		if *update {
+			if err := ioutil.WriteFile(fn, []byte(actual), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		expected, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Errorf("%s: %v (run with -update to create)", pp.URL, err)
+		} else if actual != string(expected) {
+			t.Errorf("%s: buildTelegramMarkdown differs from %s:\n%s\nwanted:\n%s", pp.URL, fn, actual, expected)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(goldenDir, "*.golden"))
+	for _, fn := range files {
+		if !expectedFiles[filepath.Base(fn)] {
+			t.Errorf("%s has no matching mock post (run with -update to remove)", fn)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/hn"
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/pinboard"
+)
+
+// HNOptions configure fetching the Hacker News stories linked from posts.
+type HNOptions struct {
+	hn.Options
+	// Lookup fetches the story of a post having an HN link, to show its
+	// score and comment count during review and fill in a missing title.
+	Lookup bool
+	// CommentCounts renders the HN link like "HN (312 comments)".
+	CommentCounts bool
+	// Discover searches HN for the URL of a post without an HN link and
+	// suggests adding the most upvoted discussion found.
+	Discover bool
+}
+
+// lookupHN fetches the HN story linked from the post. Failures are only
+// logged: the post can be published without it.
+func (env *Env) lookupHN(post *Post) *hn.Item {
+	if !env.Conf.HN.Lookup {
+		return nil
+	}
+	id, ok := hn.ParseDiscussionURL(post.Links[LinkNameHN])
+	if !ok {
+		return nil
+	}
+	item, err := env.HN.Item(id)
+	if err != nil {
+		log.Printf("[hn] WARNING: %v", err)
+		return nil
+	}
+
+	if hnURLDiffers(item, post) {
+		log.Printf("[hn] WARNING: HN story %d links to %s, not %s", item.ID, item.URL, post.URL)
+	}
+	if post.Title == "" {
+		post.Title = item.Title
+	}
+	if env.Conf.HN.CommentCounts {
+		setComments(post.StickyLinks, LinkNameHN, item.Descendants)
+		setComments(post.LinkButtons, LinkNameHN, item.Descendants)
+	}
+	return item
+}
+
+// previewArticle previews the article of an HN bookmark rather than the
+// HN discussion it links to.
+func (env *Env) previewArticle(post *Post) {
+	if !env.Conf.HN.Lookup || !post.TitleIsLink || post.Preview == nil || post.Preview.URL != "" {
+		return
+	}
+	id, ok := hn.ParseDiscussionURL(post.URL)
+	if !ok {
+		return
+	}
+	item, err := env.HN.Item(id)
+	if err != nil {
+		log.Printf("[hn] WARNING: %v", err)
+		return
+	}
+	post.Preview.URL = item.URL
+}
+
+func hnURLDiffers(item *hn.Item, post *Post) bool {
+	return item.URL != "" && CanonicalURL(item.URL) != CanonicalURL(post.URL)
+}
+
+func setComments(links []Link, key string, comments int) {
+	for i := range links {
+		if links[i].Key == key {
+			links[i].Comments = comments
+		}
+	}
+}
+
+// discoverHN finds the most upvoted HN story submitted with the post URL.
+func (env *Env) discoverHN(post *Post) *hn.Hit {
+	if !env.Conf.HN.Discover || post.Links[LinkNameHN] != "" || post.Options.NoHN {
+		return nil
+	}
+	hits, err := env.HN.SearchByURL(post.URL)
+	if err != nil {
+		log.Printf("[hn] WARNING: %v", err)
+		return nil
+	}
+
+	var best *hn.Hit
+	canon := CanonicalURL(post.URL)
+	for _, hit := range hits {
+		if CanonicalURL(hit.URL) == canon && (best == nil || hit.Points > best.Points) {
+			best = hit
+		}
+	}
+	return best
+}
+
+// acceptHNSuggestion adds the suggested HN link to the pending post, keeping
+// the changes made during review. The link is also saved to the Pinboard
+// bookmark, which stays the source of truth.
+func (env *Env) acceptHNSuggestion(pending *pendingPost) {
+	hit, post := pending.hnSuggestion, pending.post
+	link := hn.DiscussionURL(hit.ID)
+	post.Links[LinkNameHN] = link
+	if containsTag(env.Conf.Content.StickyLinks, LinkNameHN) {
+		post.insertStickyLink(Link{Key: LinkNameHN, URL: link}, env.Conf.Content)
+	}
+	if env.Conf.HN.Lookup {
+		// the search hit tells as much as a lookup would
+		pending.hn = &hn.Item{ID: hit.ID, Title: hit.Title, URL: hit.URL, Score: hit.Points, Descendants: hit.NumComments}
+		if post.Title == "" {
+			post.Title = hit.Title
+		}
+		if env.Conf.HN.CommentCounts {
+			setComments(post.StickyLinks, LinkNameHN, hit.NumComments)
+			setComments(post.LinkButtons, LinkNameHN, hit.NumComments)
+		}
+	}
+	pending.hnSuggestion = nil
+
+	c := pending.cand
+	if c.Source != SourcePinboard {
+		return
+	}
+	if env.Conf.Telegram.DryMode {
+		log.Printf("[pinboard] dry run, not adding %s to %s", link, c.URL)
+		return
+	}
+	err := updateBookmark(env.Pinboard, c.URL, func(post *pinboard.Post) bool {
+		if _, links, _ := parseTrailingLinks(post.Description); links[LinkNameHN] != "" {
+			return false
+		}
+		post.Description = addTrailingLink(post.Description, link)
+		return true
+	})
+	if err != nil {
+		log.Printf("[pinboard] WARNING: cannot add %s to %s: %v", link, c.URL, err)
+	}
+}
+
+// addTrailingLink appends a bare link to the trailing links of the
+// description, starting them if there are none.
+func addTrailingLink(desc, link string) string {
+	desc = strings.TrimSpace(desc)
+	text, links, directives := parseTrailingLinks(desc)
+	switch {
+	case len(links) > 0:
+		return desc + "\n" + link
+	case len(directives) > 0:
+		// the directives might not be separated by a blank line
+		return strings.TrimSpace(text) + "\n\n" + link + "\n" + strings.Join(directives, " ")
+	default:
+		// the blank line marks the trailing links even with no text
+		return desc + "\n\n" + link
+	}
+}
+
+// hnSummary describes the HN story of the pending post for the reviewer.
+func (pending *pendingPost) hnSummary() string {
+	item := pending.hn
+	if item == nil {
+		return ""
+	}
+	s := describeStory(item.Score, item.Descendants, item.Title)
+	if hnURLDiffers(item, pending.post) {
+		s += " (⚠️ links to " + item.URL + ")"
+	}
+	return s
+}
+
+// hnSuggestionSummary describes the HN discussion found for the pending post.
+func (pending *pendingPost) hnSuggestionSummary() string {
+	hit := pending.hnSuggestion
+	if hit == nil {
+		return ""
+	}
+	return hn.DiscussionURL(hit.ID) + " — " + describeStory(hit.Points, hit.NumComments, hit.Title)
+}
+
+func describeStory(points, comments int, title string) string {
+	return fmt.Sprintf("%s, %s: %s", pluralize(points, "point"), pluralize(comments, "comment"), title)
+}
+
+func pluralize(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
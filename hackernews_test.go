@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/hn"
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/telegram"
+)
+
+func TestAddTrailingLink(t *testing.T) {
+	const hn = "https://news.ycombinator.com/item?id=1"
+	tests := []struct {
+		Input    string
+		Expected string
+	}{
+		{"", "\n\n" + hn},
+		{"Worth reading.", "Worth reading.\n\n" + hn},
+		{"Worth reading.\n\nhttps://lobste.rs/s/abc123\n", "Worth reading.\n\nhttps://lobste.rs/s/abc123\n" + hn},
+		{"Worth reading.\n!wow", "Worth reading.\n!wow\n\n" + hn},
+		{"Worth reading.\n\n!pin", "Worth reading.\n\n" + hn + "\n!pin"},
+	}
+	for _, test := range tests {
+		actual := addTrailingLink(test.Input, hn)
+		if actual != test.Expected {
+			t.Errorf("addTrailingLink(%q) = %q, wanted %q", test.Input, actual, test.Expected)
+		}
+		if _, links, _ := parseTrailingLinks(actual); links[LinkNameHN] != hn {
+			t.Errorf("addTrailingLink(%q) = %q, which has no HN link", test.Input, actual)
+		}
+	}
+}
+
+type countingTransport struct {
+	count int
+}
+
+func (ct *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ct.count++
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestAcceptHNSuggestionKeepsReviewChanges(t *testing.T) {
+	tg := newFakeTelegram(t)
+	defer tg.Close()
+	hs := newFakeHN(t)
+	defer hs.Close()
+
+	env := newDecideTestEnv(t, tg, false,
+		&Destination{Key: ChannelTelegram, Chat: telegram.Chat{ID: "@chan"}, ParseMode: telegram.ParseModeMarkdownV2},
+	)
+	security := &Category{Tags: []string{"security"}, Title: "Security"}
+	env.Conf.Content.Categories = append(env.Conf.Content.Categories, security)
+	env.Conf.Content.StickyLinks = []string{"HN", "Lobsters"}
+	env.Conf.Telegram.DryMode = true
+	env.Conf.HN = HNOptions{Lookup: true, Discover: true}
+	counter := &countingTransport{}
+	env.HN = hn.NewClient(hn.Options{Transport: counter, BaseURL: hs.URL, SearchBaseURL: hs.URL})
+
+	pending, err := env.prepare(&Candidate{
+		URL:         "https://example.com/first",
+		Tags:        []string{"ytn", "tools"},
+		Description: "Worth reading.\n\nhttps://lobste.rs/s/abc123",
+	})
+	if err != nil || pending == nil || pending.hnSuggestion == nil {
+		t.Fatalf("prepare = %v, %v, wanted an HN suggestion", pending, err)
+	}
+	requests := counter.count
+
+	env.changeCategory(pending, security)
+	env.acceptHNSuggestion(pending)
+
+	if pending.post.Category != security {
+		t.Errorf("category = %v, wanted the changed one", pending.post.Category)
+	}
+	var keys []string
+	for _, l := range pending.post.StickyLinks {
+		keys = append(keys, l.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"HN", "Lobsters"}) || pending.post.StickyLinks[0].URL != "https://news.ycombinator.com/item?id=1" {
+		t.Errorf("sticky links = %v, wanted the HN link first", pending.post.StickyLinks)
+	}
+	if pending.post.Title != "First Article on HN" || pending.hnSummary() == "" || pending.hnSuggestion != nil {
+		t.Errorf("title = %q, HN = %q, suggestion = %v, wanted them taken from the suggestion", pending.post.Title, pending.hnSummary(), pending.hnSuggestion)
+	}
+	if counter.count != requests {
+		t.Errorf("made %d more HN requests, wanted none", counter.count-requests)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseImageLink(t *testing.T) {
+	const dir = "/srv/images"
+	tests := []struct {
+		Input    string
+		Dir      string
+		Expected string
+	}{
+		{"https://example.com/a.png", "", "https://example.com/a.png"},
+		{"/srv/images/a.png", dir, "/srv/images/a.png"},
+		{"file:///srv/images/sub/a.png", dir, "/srv/images/sub/a.png"},
+		{"./a.png", dir, "/srv/images/a.png"},
+		{"./a.png", "", "ERROR"},
+		{"/etc/passwd", dir, "ERROR"},
+		{"~/.ssh/id_rsa", dir, "ERROR"},
+		{"./../secret.png", dir, "ERROR"},
+		{"/srv/images/../secret.png", dir, "ERROR"},
+		{"/srv/images-other/a.png", dir, "ERROR"},
+	}
+	for _, test := range tests {
+		var actual string
+		photo, err := parseImageLink(test.Input, test.Dir)
+		switch {
+		case err != nil:
+			actual = "ERROR"
+		case photo.URL != "":
+			actual = photo.URL
+		default:
+			actual = photo.Path
+		}
+		if actual != test.Expected {
+			t.Errorf("parseImageLink(%q, %q) = %q, wanted %q", test.Input, test.Dir, actual, test.Expected)
+		}
+	}
+}
+
+func TestCheckImage(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	dir := filepath.Join(tmp, "images")
+	os.Mkdir(dir, 0755)
+	ioutil.WriteFile(filepath.Join(dir, "a.png"), []byte("png"), 0644)
+	ioutil.WriteFile(filepath.Join(tmp, "secret.png"), []byte("secret"), 0644)
+	if err := os.Symlink(filepath.Join(tmp, "secret.png"), filepath.Join(dir, "link.png")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name  string
+		Valid bool
+	}{
+		{"a.png", true},
+		{"missing.png", false},
+		{"link.png", false},
+	}
+	for _, test := range tests {
+		photo, err := parseImageLink("./"+test.Name, dir)
+		if err != nil {
+			t.Fatalf("parseImageLink(%q) failed: %v", test.Name, err)
+		}
+		err = checkImage(photo, dir)
+		if valid := err == nil; valid != test.Valid {
+			t.Errorf("checkImage(%q) = %v, wanted valid = %v", test.Name, err, test.Valid)
+		}
+	}
+}
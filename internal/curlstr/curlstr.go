@@ -1,29 +1,82 @@
 package curlstr
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"regexp"
+	"sort"
 	"strings"
+	"unicode/utf8"
 )
 
+// Redact makes CurlString hide credentials: the Authorization header,
+// the Telegram bot token in the path and Pinboard's auth_token param.
+// Turn it off to get commands that can be pasted as is.
+var Redact = true
+
+const redacted = "REDACTED"
+
+// maxBody is the longest body included in the command; longer or binary
+// bodies (like file uploads) are omitted.
+const maxBody = 16 * 1024
+
+var (
+	botTokenRe  = regexp.MustCompile(`/bot[^/]+/`)
+	authTokenRe = regexp.MustCompile(`(^|&)(auth_token=)[^&]*`)
+)
+
+// CurlString returns a curl command line that sends the same request.
+// It reads the body via GetBody, or reads and replaces Body if necessary.
 func CurlString(r *http.Request) string {
-	var args []string
-	args = append(args, "curl")
-	if r.Method != http.MethodGet {
+	args := []string{"curl"}
+
+	u := *r.URL
+	query := u.RawQuery
+	u.RawQuery = ""
+	if Redact {
+		u.Path = botTokenRe.ReplaceAllString(u.Path, "/bot"+redacted+"/")
+		u.RawPath = ""
+		query = authTokenRe.ReplaceAllString(query, "${1}${2}"+redacted)
+	}
+
+	body, hasBody := readBody(r)
+	if r.Method != http.MethodGet || hasBody {
 		args = append(args, "-X", r.Method)
 	}
 
-	u := *r.URL
-	for k, vv := range u.Query() {
-		for _, v := range vv {
-			args = append(args, "-d", fmt.Sprintf("%s=%s", k, v))
+	keys := make([]string, 0, len(r.Header))
+	for k := range r.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range r.Header[k] {
+			if Redact && http.CanonicalHeaderKey(k) == "Authorization" {
+				v = redactAuthorization(v)
+			}
+			args = append(args, "-H", fmt.Sprintf("%s: %s", k, v))
 		}
 	}
-	u.RawQuery = ""
 
-	for k, vv := range r.Header {
-		for _, v := range vv {
-			args = append(args, "-H", fmt.Sprintf("%s: %s", k, v))
+	if query != "" {
+		if hasBody {
+			// -G would turn the body into query params
+			u.RawQuery = query
+		} else {
+			args = append(args, "-G")
+			for _, param := range strings.Split(query, "&") {
+				args = append(args, "-d", param)
+			}
+		}
+	}
+
+	if hasBody {
+		if len(body) > maxBody || !utf8.Valid(body) {
+			args = append(args, "--data-binary", fmt.Sprintf("<%d bytes omitted>", len(body)))
+		} else {
+			args = append(args, "--data-binary", string(body))
 		}
 	}
 
@@ -35,10 +88,40 @@ func CurlString(r *http.Request) string {
 	return strings.Join(args, " ")
 }
 
+func readBody(r *http.Request) ([]byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, false
+	}
+	if r.GetBody != nil {
+		rc, err := r.GetBody()
+		if err != nil {
+			return nil, false
+		}
+		defer rc.Close()
+		body, _ := ioutil.ReadAll(rc)
+		return body, len(body) > 0
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, len(body) > 0
+}
+
+func redactAuthorization(v string) string {
+	if i := strings.IndexByte(v, ' '); i > 0 {
+		return v[:i+1] + redacted
+	}
+	return redacted
+}
+
+func isSafe(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:@%+=,", r)
+}
+
+// quote quotes the argument for POSIX shells, if necessary.
 func quote(v string) string {
-	if strings.ContainsAny(v, "'\" $&|;{}\n") {
-		return "'" + strings.ReplaceAll(strings.ReplaceAll(v, "\\", "\\\\"), "'", "\\'") + "'"
-	} else {
+	if v != "" && strings.IndexFunc(v, func(r rune) bool { return !isSafe(r) }) < 0 {
 		return v
 	}
+	return "'" + strings.ReplaceAll(v, "'", `'\''`) + "'"
 }
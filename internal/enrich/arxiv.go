@@ -0,0 +1,87 @@
+package enrich
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	httpsimp "github.com/andreyvit/httpsimplified/v2"
+)
+
+const defaultArxivBaseURL = "https://export.arxiv.org"
+
+// Arxiv fetches the title and the authors of a paper via the arXiv API.
+type Arxiv struct {
+	HTTPClient *http.Client
+	BaseURL    string
+}
+
+// arxivPathRe matches both new-style (2011.01234v2) and old-style
+// (cs/0112017) IDs on the abstract and PDF pages.
+var arxivPathRe = regexp.MustCompile(`^/(?:abs|pdf)/(\d{4}\.\d{4,5}(?:v\d+)?|[a-z-]+(?:\.[A-Z]{2})?/\d{7}(?:v\d+)?)(?:\.pdf)?/?$`)
+
+func (*Arxiv) Name() string {
+	return "arxiv"
+}
+
+func (*Arxiv) Accepts(u *url.URL) bool {
+	_, ok := arxivID(u)
+	return ok
+}
+
+func arxivID(u *url.URL) (string, bool) {
+	if u.Host != "arxiv.org" && u.Host != "www.arxiv.org" {
+		return "", false
+	}
+	m := arxivPathRe.FindStringSubmatch(u.Path)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+func (e *Arxiv) Fetch(u *url.URL) (*Metadata, error) {
+	id, _ := arxivID(u)
+	baseURL := e.BaseURL
+	if baseURL == "" {
+		baseURL = defaultArxivBaseURL
+	}
+	r := httpsimp.MakeGet(baseURL, "/api/query", url.Values{"id_list": []string{id}}, http.Header{})
+	log.Printf("[enrich] GET %s", r.URL)
+
+	var raw []byte
+	if err := httpsimp.Do(r, e.HTTPClient, httpsimp.Bytes(&raw)); err != nil {
+		return nil, fmt.Errorf("paper %s: %w", id, err)
+	}
+	var feed struct {
+		Entries []struct {
+			Title   string `xml:"title"`
+			Authors []struct {
+				Name string `xml:"name"`
+			} `xml:"author"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(raw, &feed); err != nil {
+		return nil, fmt.Errorf("paper %s: cannot decode response: %w", id, err)
+	}
+	// an unknown ID yields an entry without a title
+	if len(feed.Entries) == 0 || feed.Entries[0].Title == "" {
+		return nil, nil
+	}
+
+	entry := feed.Entries[0]
+	meta := &Metadata{
+		Title:       strings.Join(strings.Fields(entry.Title), " "),
+		SiteName:    "arXiv",
+		AbstractURL: "https://arxiv.org/abs/" + id,
+		PDFURL:      "https://arxiv.org/pdf/" + id,
+	}
+	for _, a := range entry.Authors {
+		meta.Authors = append(meta.Authors, a.Name)
+	}
+	return meta, nil
+}
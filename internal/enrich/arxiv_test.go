@@ -0,0 +1,69 @@
+package enrich
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestArxivID(t *testing.T) {
+	tests := []struct {
+		Input    string
+		Expected string
+	}{
+		{"https://arxiv.org/abs/2011.01234", "2011.01234"},
+		{"https://arxiv.org/abs/2011.01234v2", "2011.01234v2"},
+		{"https://arxiv.org/pdf/2011.01234.pdf", "2011.01234"},
+		{"https://arxiv.org/abs/cs/0112017", "cs/0112017"},
+		{"https://arxiv.org/list/cs.LG/recent", ""},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse(test.Input)
+		actual, _ := arxivID(u)
+		if actual != test.Expected {
+			t.Errorf("arxivID(%q) = %q, wanted %q", test.Input, actual, test.Expected)
+		}
+	}
+}
+
+const arxivFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title type="html">ArXiv Query: id_list=2011.01234</title>
+  <entry>
+    <id>http://arxiv.org/abs/2011.01234v1</id>
+    <title>A Very
+  Long Title</title>
+    <author><name>Alice</name></author>
+    <author><name>Bob</name></author>
+  </entry>
+</feed>`
+
+func TestArxivFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/query" || r.URL.Query().Get("id_list") != "2011.01234" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		w.Write([]byte(arxivFeed))
+	}))
+	defer srv.Close()
+	e := &Arxiv{HTTPClient: srv.Client(), BaseURL: srv.URL}
+
+	u, _ := url.Parse("https://arxiv.org/pdf/2011.01234.pdf")
+	meta, err := e.Fetch(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Metadata{
+		Title:       "A Very Long Title",
+		SiteName:    "arXiv",
+		Authors:     []string{"Alice", "Bob"},
+		AbstractURL: "https://arxiv.org/abs/2011.01234",
+		PDFURL:      "https://arxiv.org/pdf/2011.01234",
+	}
+	if !reflect.DeepEqual(meta, expected) {
+		t.Errorf("Fetch = %+v, wanted %+v", meta, expected)
+	}
+}
@@ -0,0 +1,78 @@
+package enrich
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/renameio"
+)
+
+// Cache keeps the fetched metadata in a directory, one file per URL and
+// enricher. A nil *Cache caches nothing.
+type Cache struct {
+	Dir string
+	// TTL is how long the entries stay fresh; zero means forever.
+	TTL time.Duration
+
+	now func() time.Time
+}
+
+type cacheEntry struct {
+	Time time.Time `json:"t"`
+	// Meta is nil if the enricher has found nothing, which is cached too.
+	Meta *Metadata `json:"meta"`
+}
+
+func (c *Cache) path(enricher, rawURL string) string {
+	hash := sha1.Sum([]byte(rawURL))
+	return filepath.Join(c.Dir, enricher+"-"+hex.EncodeToString(hash[:])+".json")
+}
+
+func (c *Cache) doNow() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// Get returns the cached metadata, if any and still fresh.
+func (c *Cache) Get(enricher, rawURL string) (*Metadata, bool) {
+	if c == nil {
+		return nil, false
+	}
+	raw, err := ioutil.ReadFile(c.path(enricher, rawURL))
+	if err != nil {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil, false
+	}
+	if c.TTL != 0 && c.doNow().Sub(entry.Time) > c.TTL {
+		return nil, false
+	}
+	return entry.Meta, true
+}
+
+func (c *Cache) Put(enricher, rawURL string, meta *Metadata) error {
+	if c == nil {
+		return nil
+	}
+	raw, err := json.Marshal(&cacheEntry{Time: c.doNow(), Meta: meta})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return fmt.Errorf("enrich cache: %w", err)
+	}
+	if err := renameio.WriteFile(c.path(enricher, rawURL), raw, 0644); err != nil {
+		return fmt.Errorf("enrich cache: %w", err)
+	}
+	return nil
+}
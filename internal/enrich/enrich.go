@@ -0,0 +1,143 @@
+// Package enrich fetches metadata about the links being published from
+// the sites they point to, like the stars of a GitHub repository.
+package enrich
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Enricher knows about the links of a particular site (or of any site).
+type Enricher interface {
+	// Name identifies the enricher in the cache and in the logs.
+	Name() string
+	// Accepts tells whether the enricher handles the URL.
+	Accepts(u *url.URL) bool
+	// Fetch returns the metadata of the URL, or nil if there is none.
+	Fetch(u *url.URL) (*Metadata, error)
+}
+
+// Metadata is what an enricher has found out about a link. Only the fields
+// relevant to the site are set.
+type Metadata struct {
+	Enricher string `json:"enricher"`
+	Title    string `json:"title,omitempty"`
+	SiteName string `json:"site,omitempty"`
+
+	// Repo is "owner/repo" on GitHub.
+	Repo     string `json:"repo,omitempty"`
+	Stars    int    `json:"stars,omitempty"`
+	Language string `json:"lang,omitempty"`
+
+	Authors     []string `json:"authors,omitempty"`
+	AbstractURL string   `json:"abstract,omitempty"`
+	PDFURL      string   `json:"pdf,omitempty"`
+
+	Channel  string        `json:"channel,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// String is a one-line summary for the reviewer.
+func (m *Metadata) String() string {
+	if m == nil {
+		return ""
+	}
+	var items []string
+	add := func(s string) {
+		if s != "" {
+			items = append(items, s)
+		}
+	}
+	add(m.SiteName)
+	add(m.Repo)
+	if m.Stars > 0 {
+		add("★ " + strconv.Itoa(m.Stars))
+	}
+	add(m.Language)
+	if len(m.Authors) > 3 {
+		add(strings.Join(m.Authors[:3], ", ") + " et al.")
+	} else {
+		add(strings.Join(m.Authors, ", "))
+	}
+	add(m.Channel)
+	if m.Duration > 0 {
+		add(m.Duration.String())
+	}
+	if m.Title != "" {
+		add(fmt.Sprintf("%q", m.Title))
+	}
+	return strings.Join(items, " · ")
+}
+
+type Options struct {
+	Transport http.RoundTripper
+	// UserAgent, if set, is sent when fetching pages.
+	UserAgent string
+	// GitHubToken raises the GitHub API rate limit; optional.
+	GitHubToken string
+	// CacheDir, if set, keeps the results there for CacheTTL.
+	CacheDir string
+	CacheTTL time.Duration
+}
+
+// NewPipeline returns the site-specific enrichers followed by the generic
+// OpenGraph one.
+func NewPipeline(opt Options) *Pipeline {
+	client := &http.Client{
+		Transport: opt.Transport,
+		Timeout:   10 * time.Second,
+	}
+	p := &Pipeline{
+		Enrichers: []Enricher{
+			&GitHub{HTTPClient: client, Token: opt.GitHubToken},
+			&Arxiv{HTTPClient: client},
+			&YouTube{HTTPClient: client, UserAgent: opt.UserAgent},
+			&OpenGraph{HTTPClient: client, UserAgent: opt.UserAgent},
+		},
+	}
+	if opt.CacheDir != "" {
+		p.Cache = &Cache{Dir: opt.CacheDir, TTL: opt.CacheTTL}
+	}
+	return p
+}
+
+// Pipeline runs the first enricher accepting the URL, caching the results.
+type Pipeline struct {
+	Enrichers []Enricher
+	// Cache is optional.
+	Cache *Cache
+}
+
+// Enrich returns the metadata of the URL, or nil if no enricher has any.
+func (p *Pipeline) Enrich(rawURL string) (*Metadata, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range p.Enrichers {
+		if !e.Accepts(u) {
+			continue
+		}
+
+		if meta, ok := p.Cache.Get(e.Name(), rawURL); ok {
+			return meta, nil
+		}
+		meta, err := e.Fetch(u)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Name(), err)
+		}
+		if meta != nil {
+			meta.Enricher = e.Name()
+		}
+		if err := p.Cache.Put(e.Name(), rawURL, meta); err != nil {
+			log.Printf("[enrich] WARNING: %v", err)
+		}
+		return meta, nil
+	}
+	return nil, nil
+}
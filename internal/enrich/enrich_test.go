@@ -0,0 +1,121 @@
+package enrich
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fakeEnricher struct {
+	name    string
+	host    string
+	meta    *Metadata
+	err     error
+	fetches int
+}
+
+func (e *fakeEnricher) Name() string            { return e.name }
+func (e *fakeEnricher) Accepts(u *url.URL) bool { return e.host == "" || u.Host == e.host }
+
+func (e *fakeEnricher) Fetch(u *url.URL) (*Metadata, error) {
+	e.fetches++
+	if e.meta == nil {
+		return nil, e.err
+	}
+	meta := *e.meta
+	return &meta, e.err
+}
+
+func TestPipelineEnrich(t *testing.T) {
+	dir, err := ioutil.TempDir("", "enrich")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	site := &fakeEnricher{name: "site", host: "example.com", meta: &Metadata{Title: "Site"}}
+	generic := &fakeEnricher{name: "generic"}
+	p := &Pipeline{
+		Enrichers: []Enricher{site, generic},
+		Cache:     &Cache{Dir: dir, TTL: time.Hour},
+	}
+
+	for i := 0; i < 2; i++ {
+		meta, err := p.Enrich("https://example.com/a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := &Metadata{Enricher: "site", Title: "Site"}
+		if !reflect.DeepEqual(meta, expected) {
+			t.Errorf("Enrich = %+v, wanted %+v", meta, expected)
+		}
+
+		// nothing found is cached too
+		if meta, err := p.Enrich("https://other.com/"); meta != nil || err != nil {
+			t.Errorf("Enrich = %+v, %v, wanted nil", meta, err)
+		}
+	}
+	if site.fetches != 1 || generic.fetches != 1 {
+		t.Errorf("fetches = %d, %d, wanted 1, 1", site.fetches, generic.fetches)
+	}
+
+	// errors are not cached
+	failing := &fakeEnricher{name: "failing", err: errors.New("boom")}
+	p.Enrichers = []Enricher{failing}
+	for i := 0; i < 2; i++ {
+		if _, err := p.Enrich("https://example.com/b"); err == nil {
+			t.Errorf("Enrich succeeded, wanted an error")
+		}
+	}
+	if failing.fetches != 2 {
+		t.Errorf("fetches = %d, wanted 2", failing.fetches)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "enrich")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2020, 11, 10, 12, 0, 0, 0, time.UTC)
+	c := &Cache{Dir: dir, TTL: time.Hour, now: func() time.Time { return now }}
+	if err := c.Put("site", "https://example.com/", &Metadata{Title: "A"}); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(59 * time.Minute)
+	if meta, ok := c.Get("site", "https://example.com/"); !ok || meta.Title != "A" {
+		t.Errorf("Get = %+v, %v, wanted the entry", meta, ok)
+	}
+	if _, ok := c.Get("other", "https://example.com/"); ok {
+		t.Errorf("Get(other) found an entry")
+	}
+	now = now.Add(2 * time.Minute)
+	if _, ok := c.Get("site", "https://example.com/"); ok {
+		t.Errorf("Get found an expired entry")
+	}
+}
+
+func TestMetadataString(t *testing.T) {
+	tests := []struct {
+		Input    *Metadata
+		Expected string
+	}{
+		{nil, ""},
+		{&Metadata{SiteName: "GitHub", Repo: "sq5bpf/etherify", Stars: 457, Language: "C"}, "GitHub · sq5bpf/etherify · ★ 457 · C"},
+		{&Metadata{SiteName: "arXiv", Authors: []string{"A", "B", "C", "D"}, Title: "Paper"}, `arXiv · A, B, C et al. · "Paper"`},
+		{&Metadata{SiteName: "YouTube", Channel: "Chan", Duration: 253 * time.Second}, "YouTube · Chan · 4m13s"},
+	}
+	for _, test := range tests {
+		actual := test.Input.String()
+		if actual != test.Expected {
+			t.Errorf("String(%+v) = %q, wanted %q", test.Input, actual, test.Expected)
+		}
+	}
+}
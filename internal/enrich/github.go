@@ -0,0 +1,88 @@
+package enrich
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	httpsimp "github.com/andreyvit/httpsimplified/v2"
+)
+
+const defaultGitHubBaseURL = "https://api.github.com"
+
+// GitHub fetches the stars and the language of a repository via the API.
+type GitHub struct {
+	HTTPClient *http.Client
+	BaseURL    string
+	Token      string
+}
+
+// githubReserved are the top-level pages of github.com that aren't users.
+var githubReserved = map[string]bool{
+	"about": true, "collections": true, "enterprise": true, "explore": true,
+	"features": true, "marketplace": true, "orgs": true, "pricing": true,
+	"settings": true, "sponsors": true, "topics": true, "trending": true,
+}
+
+func (*GitHub) Name() string {
+	return "github"
+}
+
+func (*GitHub) Accepts(u *url.URL) bool {
+	_, ok := githubRepo(u)
+	return ok
+}
+
+// githubRepo returns "owner/repo" for any page of a repository.
+func githubRepo(u *url.URL) (string, bool) {
+	if u.Host != "github.com" && u.Host != "www.github.com" {
+		return "", false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" || githubReserved[parts[0]] {
+		return "", false
+	}
+	return parts[0] + "/" + strings.TrimSuffix(parts[1], ".git"), true
+}
+
+func (e *GitHub) Fetch(u *url.URL) (*Metadata, error) {
+	repo, _ := githubRepo(u)
+	baseURL := e.BaseURL
+	if baseURL == "" {
+		baseURL = defaultGitHubBaseURL
+	}
+	r := httpsimp.MakeGet(baseURL, "/repos/"+repo, nil, http.Header{})
+	r.Header.Set("Accept", "application/vnd.github.v3+json")
+	if e.Token != "" {
+		r.Header.Set("Authorization", "token "+e.Token)
+	}
+	log.Printf("[enrich] GET %s", r.URL)
+
+	var resp struct {
+		FullName    string `json:"full_name"`
+		Description string `json:"description"`
+		Stars       int    `json:"stargazers_count"`
+		Language    string `json:"language"`
+	}
+	err := httpsimp.Do(r, e.HTTPClient, httpsimp.JSON(&resp))
+	if httpsimp.StatusCode(err) == http.StatusNotFound {
+		// a private or deleted repository
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("repo %s: %w", repo, err)
+	}
+
+	title := resp.FullName
+	if resp.Description != "" {
+		title += ": " + resp.Description
+	}
+	return &Metadata{
+		Title:    title,
+		SiteName: "GitHub",
+		Repo:     resp.FullName,
+		Stars:    resp.Stars,
+		Language: resp.Language,
+	}, nil
+}
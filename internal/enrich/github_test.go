@@ -0,0 +1,61 @@
+package enrich
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestGitHubRepo(t *testing.T) {
+	tests := []struct {
+		Input    string
+		Expected string
+	}{
+		{"https://github.com/sq5bpf/etherify", "sq5bpf/etherify"},
+		{"https://github.com/sq5bpf/etherify/blob/master/README.md", "sq5bpf/etherify"},
+		{"https://github.com/sq5bpf/etherify.git", "sq5bpf/etherify"},
+		{"https://github.com/sq5bpf", ""},
+		{"https://github.com/topics/go", ""},
+		{"https://gitlab.com/a/b", ""},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse(test.Input)
+		actual, _ := githubRepo(u)
+		if actual != test.Expected {
+			t.Errorf("githubRepo(%q) = %q, wanted %q", test.Input, actual, test.Expected)
+		}
+	}
+}
+
+func TestGitHubFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a := r.Header.Get("Authorization"); a != "token secret" {
+			t.Errorf("Authorization = %q", a)
+		}
+		if r.URL.Path != "/repos/sq5bpf/etherify" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`{"id":1,"full_name":"sq5bpf/etherify","description":"Transmit data via ethernet cables","stargazers_count":457,"language":"C"}`))
+	}))
+	defer srv.Close()
+	e := &GitHub{HTTPClient: srv.Client(), BaseURL: srv.URL, Token: "secret"}
+
+	u, _ := url.Parse("https://github.com/sq5bpf/etherify")
+	meta, err := e.Fetch(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Metadata{Title: "sq5bpf/etherify: Transmit data via ethernet cables", SiteName: "GitHub", Repo: "sq5bpf/etherify", Stars: 457, Language: "C"}
+	if !reflect.DeepEqual(meta, expected) {
+		t.Errorf("Fetch = %+v, wanted %+v", meta, expected)
+	}
+
+	u, _ = url.Parse("https://github.com/sq5bpf/private")
+	if meta, err := e.Fetch(u); meta != nil || err != nil {
+		t.Errorf("Fetch(private) = %+v, %v, wanted nil", meta, err)
+	}
+}
@@ -0,0 +1,102 @@
+package enrich
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// maxPageSize limits how much of a page is read; the meta tags are in the
+// head anyway.
+const maxPageSize = 512 * 1024
+
+// OpenGraph reads the og:title and og:site_name meta tags of any page.
+type OpenGraph struct {
+	HTTPClient *http.Client
+	UserAgent  string
+}
+
+func (*OpenGraph) Name() string {
+	return "opengraph"
+}
+
+func (*OpenGraph) Accepts(u *url.URL) bool {
+	return u.Scheme == "http" || u.Scheme == "https"
+}
+
+func (e *OpenGraph) Fetch(u *url.URL) (*Metadata, error) {
+	page, err := getPage(e.HTTPClient, e.UserAgent, u.String())
+	if err != nil {
+		return nil, err
+	}
+	tags := parseTags(page)
+	meta := &Metadata{
+		Title:    tags.content("property", "og:title"),
+		SiteName: tags.content("property", "og:site_name"),
+	}
+	if meta.Title == "" && meta.SiteName == "" {
+		return nil, nil
+	}
+	return meta, nil
+}
+
+func getPage(client *http.Client, userAgent, u string) (string, error) {
+	log.Printf("[enrich] GET %s", u)
+	r, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return "", err
+	}
+	if userAgent != "" {
+		r.Header.Set("User-Agent", userAgent)
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	raw, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return "", fmt.Errorf("GET %s: %w", u, err)
+	}
+	return string(raw), nil
+}
+
+var (
+	tagRe  = regexp.MustCompile(`(?i)<(?:meta|link)\s[^>]*>`)
+	attrRe = regexp.MustCompile(`([a-zA-Z:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+)
+
+// tags are the attributes of the meta and link tags of a page, which is
+// all the enrichers look at, so HTML is not parsed properly.
+type tags []map[string]string
+
+func parseTags(page string) tags {
+	var result tags
+	for _, tag := range tagRe.FindAllString(page, -1) {
+		attrs := make(map[string]string)
+		for _, m := range attrRe.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(m[1])] = html.UnescapeString(m[2] + m[3])
+		}
+		result = append(result, attrs)
+	}
+	return result
+}
+
+// content returns the content of the first tag with the given attribute value.
+func (tt tags) content(attr, value string) string {
+	for _, t := range tt {
+		if t[attr] == value {
+			return strings.TrimSpace(t["content"])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package enrich
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestOpenGraphFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/post":
+			w.Write([]byte(`<html><head><meta charset="utf-8"><meta content='It&#39;s out' property='og:title' /><meta property="og:site_name" content="Blog"></head></html>`))
+		case "/plain":
+			w.Write([]byte(`<html><head><title>Plain</title></head></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	e := &OpenGraph{HTTPClient: srv.Client()}
+
+	u, _ := url.Parse(srv.URL + "/post")
+	meta, err := e.Fetch(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Metadata{Title: "It's out", SiteName: "Blog"}
+	if !reflect.DeepEqual(meta, expected) {
+		t.Errorf("Fetch = %+v, wanted %+v", meta, expected)
+	}
+
+	u, _ = url.Parse(srv.URL + "/plain")
+	if meta, err := e.Fetch(u); meta != nil || err != nil {
+		t.Errorf("Fetch(plain) = %+v, %v, wanted nil", meta, err)
+	}
+	u, _ = url.Parse(srv.URL + "/missing")
+	if _, err := e.Fetch(u); err == nil {
+		t.Errorf("Fetch(missing) succeeded, wanted an error")
+	}
+}
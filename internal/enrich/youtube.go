@@ -0,0 +1,81 @@
+package enrich
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultYouTubeBaseURL = "https://www.youtube.com"
+
+// YouTube reads the duration and the channel of a video from its page.
+type YouTube struct {
+	HTTPClient *http.Client
+	// BaseURL overrides where the watch pages are fetched from, e.g. to use
+	// a fake server.
+	BaseURL   string
+	UserAgent string
+}
+
+func (*YouTube) Name() string {
+	return "youtube"
+}
+
+func (*YouTube) Accepts(u *url.URL) bool {
+	return youtubeVideoID(u) != ""
+}
+
+func youtubeVideoID(u *url.URL) string {
+	switch u.Host {
+	case "youtu.be":
+		return strings.TrimPrefix(u.Path, "/")
+	case "youtube.com", "www.youtube.com", "m.youtube.com":
+		if u.Path == "/watch" {
+			return u.Query().Get("v")
+		}
+	}
+	return ""
+}
+
+func (e *YouTube) Fetch(u *url.URL) (*Metadata, error) {
+	baseURL := e.BaseURL
+	if baseURL == "" {
+		baseURL = defaultYouTubeBaseURL
+	}
+	page, err := getPage(e.HTTPClient, e.UserAgent, baseURL+"/watch?v="+url.QueryEscape(youtubeVideoID(u)))
+	if err != nil {
+		return nil, err
+	}
+	tags := parseTags(page)
+	meta := &Metadata{
+		Title:    tags.content("property", "og:title"),
+		SiteName: "YouTube",
+		// the channel is the name of the author, the first name on the page
+		Channel:  tags.content("itemprop", "name"),
+		Duration: parseISODuration(tags.content("itemprop", "duration")),
+	}
+	if meta.Title == "" {
+		// an unavailable video
+		return nil, nil
+	}
+	return meta, nil
+}
+
+var isoDurationRe = regexp.MustCompile(`^PT(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?$`)
+
+// parseISODuration parses durations like PT1H4M13S, returning 0 if invalid.
+func parseISODuration(s string) time.Duration {
+	m := isoDurationRe.FindStringSubmatch(s)
+	if m == nil {
+		return 0
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		n, _ := strconv.Atoi(m[i+1])
+		d += time.Duration(n) * unit
+	}
+	return d
+}
@@ -0,0 +1,63 @@
+package enrich
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseISODuration(t *testing.T) {
+	tests := []struct {
+		Input    string
+		Expected time.Duration
+	}{
+		{"PT4M13S", 4*time.Minute + 13*time.Second},
+		{"PT1H0M2S", time.Hour + 2*time.Second},
+		{"PT45S", 45 * time.Second},
+		{"", 0},
+		{"P1D", 0},
+	}
+	for _, test := range tests {
+		actual := parseISODuration(test.Input)
+		if actual != test.Expected {
+			t.Errorf("parseISODuration(%q) = %v, wanted %v", test.Input, actual, test.Expected)
+		}
+	}
+}
+
+const youtubePage = `<!DOCTYPE html><html><head>
+<meta property="og:site_name" content="YouTube">
+<meta property="og:title" content="Rust &amp; Go">
+</head><body><div id="watch7-content">
+<meta itemprop="duration" content="PT4M13S">
+<span itemprop="author" itemscope itemtype="http://schema.org/Person"><link itemprop="url" href="http://www.youtube.com/c/Chan"><link itemprop="name" content="Chan"></span>
+</div></body></html>`
+
+func TestYouTubeFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/watch" || r.URL.Query().Get("v") != "abc123" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Write([]byte(youtubePage))
+	}))
+	defer srv.Close()
+	e := &YouTube{HTTPClient: srv.Client(), BaseURL: srv.URL}
+
+	for _, s := range []string{"https://www.youtube.com/watch?v=abc123&t=10", "https://youtu.be/abc123"} {
+		u, _ := url.Parse(s)
+		if !e.Accepts(u) {
+			t.Errorf("Accepts(%q) = false", s)
+		}
+		meta, err := e.Fetch(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := &Metadata{Title: "Rust & Go", SiteName: "YouTube", Channel: "Chan", Duration: 253 * time.Second}
+		if !reflect.DeepEqual(meta, expected) {
+			t.Errorf("Fetch(%q) = %+v, wanted %+v", s, meta, expected)
+		}
+	}
+}
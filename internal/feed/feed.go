@@ -0,0 +1,195 @@
+// Package feed reads RSS 2.0 and Atom feeds.
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	httpsimp "github.com/andreyvit/httpsimplified/v2"
+)
+
+type Item struct {
+	URL         string
+	Title       string
+	Time        time.Time
+	Categories  []string
+	Description string // plain text
+}
+
+// Load fetches and parses the feed at the given URL.
+func Load(feedURL string, client *http.Client) ([]*Item, error) {
+	if client == nil {
+		client = &http.Client{
+			Timeout: 10 * time.Second,
+		}
+	}
+
+	r, err := http.NewRequest(http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[feed] GET %s", feedURL)
+
+	var data []byte
+	err = httpsimp.Do(r, client, httpsimp.Bytes(&data))
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses an RSS 2.0 or Atom document.
+func Parse(data []byte) ([]*Item, error) {
+	var doc struct {
+		XMLName xml.Name
+		Channel struct {
+			Items []rssItem `xml:"item"`
+		} `xml:"channel"`
+		Entries []atomEntry `xml:"entry"`
+	}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("feed: %w", err)
+	}
+
+	var items []*Item
+	switch doc.XMLName.Local {
+	case "rss":
+		for _, ri := range doc.Channel.Items {
+			items = append(items, ri.item())
+		}
+	case "feed":
+		for _, ae := range doc.Entries {
+			items = append(items, ae.item())
+		}
+	default:
+		return nil, fmt.Errorf("feed: unsupported document <%s>, expected RSS or Atom", doc.XMLName.Local)
+	}
+	return items, nil
+}
+
+type rssItem struct {
+	Link        string   `xml:"link"`
+	GUID        string   `xml:"guid"`
+	Title       string   `xml:"title"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+func (ri *rssItem) item() *Item {
+	link := strings.TrimSpace(ri.Link)
+	if link == "" && strings.HasPrefix(ri.GUID, "http") {
+		link = strings.TrimSpace(ri.GUID)
+	}
+	return &Item{
+		URL:         link,
+		Title:       strings.TrimSpace(ri.Title),
+		Time:        parseTime(ri.PubDate),
+		Categories:  trimAll(ri.Categories),
+		Description: PlainText(ri.Description),
+	}
+}
+
+type atomEntry struct {
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	Title      string `xml:"title"`
+	Published  string `xml:"published"`
+	Updated    string `xml:"updated"`
+	Categories []struct {
+		Term string `xml:"term,attr"`
+	} `xml:"category"`
+	Summary string `xml:"summary"`
+	Content string `xml:"content"`
+}
+
+func (ae *atomEntry) item() *Item {
+	item := &Item{
+		Title: strings.TrimSpace(ae.Title),
+		Time:  parseTime(ae.Published),
+	}
+	if item.Time.IsZero() {
+		item.Time = parseTime(ae.Updated)
+	}
+	for _, l := range ae.Links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			item.URL = l.Href
+			break
+		}
+	}
+	for _, c := range ae.Categories {
+		if c.Term != "" {
+			item.Categories = append(item.Categories, c.Term)
+		}
+	}
+	if ae.Summary != "" {
+		item.Description = PlainText(ae.Summary)
+	} else {
+		item.Description = PlainText(ae.Content)
+	}
+	return item
+}
+
+var timeLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+}
+
+func parseTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+var (
+	tagRe        = regexp.MustCompile(`<[^>]*>`)
+	blockTagRe   = regexp.MustCompile(`(?i)<(?:br\s*/?|/p|/div|/li|/blockquote)>`)
+	blankLinesRe = regexp.MustCompile(`\n{3,}`)
+)
+
+// PlainText converts an HTML fragment into plain text, keeping paragraph breaks.
+func PlainText(s string) string {
+	s = blockTagRe.ReplaceAllString(s, "\n\n")
+	s = tagRe.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	s = strings.Join(lines, "\n")
+	s = blankLinesRe.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
+
+func trimAll(list []string) []string {
+	var result []string
+	for _, s := range list {
+		if s = strings.TrimSpace(s); s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
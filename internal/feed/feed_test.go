@@ -0,0 +1,67 @@
+package feed
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		Input    string
+		Expected []*Item
+	}{
+		{
+			`<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Starred</title>
+<item>
+  <title>Some &amp; Article</title>
+  <link>https://example.com/a</link>
+  <pubDate>Mon, 09 Nov 2020 16:00:00 +0000</pubDate>
+  <category>security</category>
+  <description>&lt;p&gt;First &lt;b&gt;para&lt;/b&gt;.&lt;/p&gt;&lt;p&gt;Second.&lt;/p&gt;</description>
+</item>
+<item>
+  <guid>https://example.com/b</guid>
+</item>
+</channel></rss>`,
+			[]*Item{
+				{URL: "https://example.com/a", Title: "Some & Article", Time: time.Date(2020, 11, 9, 16, 0, 0, 0, time.UTC), Categories: []string{"security"}, Description: "First para.\n\nSecond."},
+				{URL: "https://example.com/b"},
+			},
+		},
+		{
+			`<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <entry>
+    <title>Atom Entry</title>
+    <link rel="self" href="https://example.com/self"/>
+    <link href="https://example.com/c"/>
+    <updated>2020-11-09T16:00:00Z</updated>
+    <category term="tools"/>
+    <content type="html">Hello</content>
+  </entry>
+</feed>`,
+			[]*Item{
+				{URL: "https://example.com/c", Title: "Atom Entry", Time: time.Date(2020, 11, 9, 16, 0, 0, 0, time.UTC), Categories: []string{"tools"}, Description: "Hello"},
+			},
+		},
+	}
+	for _, test := range tests {
+		actual, err := Parse([]byte(test.Input))
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", test.Input, err)
+			continue
+		}
+		for _, item := range actual {
+			item.Time = item.Time.UTC()
+		}
+		if !reflect.DeepEqual(actual, test.Expected) {
+			t.Errorf("Parse(%q) = %+v, wanted %+v", test.Input, actual, test.Expected)
+		}
+	}
+
+	if _, err := Parse([]byte(`<html></html>`)); err == nil {
+		t.Errorf("Parse(html) succeeded, wanted an error")
+	}
+}
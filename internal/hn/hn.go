@@ -0,0 +1,132 @@
+// Package hn reads Hacker News stories via the official Firebase API and
+// finds them via the Algolia search API.
+package hn
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	httpsimp "github.com/andreyvit/httpsimplified/v2"
+)
+
+const (
+	defaultBaseURL       = "https://hacker-news.firebaseio.com/v0"
+	defaultSearchBaseURL = "https://hn.algolia.com/api/v1"
+)
+
+var ErrNotFound = errors.New("item not found")
+
+type Options struct {
+	Transport http.RoundTripper
+	// BaseURL and SearchBaseURL override the Firebase and Algolia API
+	// endpoints.
+	BaseURL       string
+	SearchBaseURL string
+}
+
+type Client struct {
+	HTTPClient    *http.Client
+	BaseURL       string
+	SearchBaseURL string
+}
+
+func NewClient(opt Options) *Client {
+	baseURL := opt.BaseURL
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	searchBaseURL := opt.SearchBaseURL
+	if searchBaseURL == "" {
+		searchBaseURL = defaultSearchBaseURL
+	}
+	return &Client{
+		HTTPClient: &http.Client{
+			Transport: opt.Transport,
+			Timeout:   10 * time.Second,
+		},
+		BaseURL:       baseURL,
+		SearchBaseURL: searchBaseURL,
+	}
+}
+
+// Item is a story (or any other item, like a comment). URL is empty for
+// text posts like Ask HN.
+type Item struct {
+	ID          int    `json:"id"`
+	Type        string `json:"type"`
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	Score       int    `json:"score"`
+	Descendants int    `json:"descendants"` // the number of comments
+	Dead        bool   `json:"dead"`
+	Deleted     bool   `json:"deleted"`
+}
+
+func (item *Item) DiscussionURL() string {
+	return DiscussionURL(item.ID)
+}
+
+// Item fetches the item with the given ID.
+func (c *Client) Item(id int) (*Item, error) {
+	r := httpsimp.MakeGet(c.BaseURL, fmt.Sprintf("/item/%d.json", id), nil, http.Header{})
+	log.Printf("[hn] GET %s", r.URL)
+
+	// a missing item is a literal null
+	var item *Item
+	if err := httpsimp.Do(r, c.HTTPClient, httpsimp.JSON(&item)); err != nil {
+		return nil, fmt.Errorf("hn item %d: %w", id, err)
+	}
+	if item == nil {
+		return nil, fmt.Errorf("hn item %d: %w", id, ErrNotFound)
+	}
+	return item, nil
+}
+
+// Hit is a story found by SearchByURL.
+type Hit struct {
+	ID          int    `json:"objectID,string"`
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	Points      int    `json:"points"`
+	NumComments int    `json:"num_comments"`
+}
+
+// SearchByURL finds the stories submitted with the given URL, most relevant
+// first. Since the search is full-text, the hits can have other URLs too.
+func (c *Client) SearchByURL(u string) ([]*Hit, error) {
+	params := url.Values{
+		"query":                        []string{u},
+		"restrictSearchableAttributes": []string{"url"},
+		"tags":                         []string{"story"},
+	}
+	r := httpsimp.MakeGet(c.SearchBaseURL, "/search", params, http.Header{})
+	log.Printf("[hn] GET %s", r.URL)
+
+	var resp struct {
+		Hits []*Hit `json:"hits"`
+	}
+	if err := httpsimp.Do(r, c.HTTPClient, httpsimp.JSON(&resp)); err != nil {
+		return nil, fmt.Errorf("hn search: %w", err)
+	}
+	return resp.Hits, nil
+}
+
+// DiscussionURL returns the news.ycombinator.com page of the item.
+func DiscussionURL(id int) string {
+	return "https://news.ycombinator.com/item?id=" + strconv.Itoa(id)
+}
+
+// ParseDiscussionURL returns the item ID from a news.ycombinator.com link.
+func ParseDiscussionURL(s string) (int, bool) {
+	u, err := url.Parse(s)
+	if err != nil || u.Host != "news.ycombinator.com" || u.Path != "/item" {
+		return 0, false
+	}
+	id, err := strconv.Atoi(u.Query().Get("id"))
+	return id, err == nil && id > 0
+}
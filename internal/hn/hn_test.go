@@ -0,0 +1,75 @@
+package hn
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestClientItem(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		switch r.URL.Path {
+		case "/item/25025552.json":
+			w.Write([]byte(`{"by":"someone","descendants":312,"id":25025552,"kids":[1,2],"score":457,"time":1604938933,"title":"Etherify","type":"story","url":"https://github.com/sq5bpf/etherify"}`))
+		default:
+			w.Write([]byte(`null`))
+		}
+	}))
+	defer srv.Close()
+	c := NewClient(Options{BaseURL: srv.URL})
+
+	item, err := c.Item(25025552)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Item{ID: 25025552, Type: "story", Title: "Etherify", URL: "https://github.com/sq5bpf/etherify", Score: 457, Descendants: 312}
+	if !reflect.DeepEqual(item, expected) {
+		t.Errorf("Item = %+v, wanted %+v", item, expected)
+	}
+
+	if _, err := c.Item(1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Item(1) = %v, wanted ErrNotFound", err)
+	}
+}
+
+func TestClientSearchByURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/search" || q.Get("query") != "https://example.com/a" || q.Get("restrictSearchableAttributes") != "url" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`{"hits":[{"created_at":"2020-11-09T16:22:13.000Z","title":"A","url":"https://example.com/a","author":"x","points":457,"num_comments":312,"objectID":"25025552"}],"nbHits":1}`))
+	}))
+	defer srv.Close()
+	c := NewClient(Options{SearchBaseURL: srv.URL})
+
+	hits, err := c.SearchByURL("https://example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*Hit{{ID: 25025552, Title: "A", URL: "https://example.com/a", Points: 457, NumComments: 312}}
+	if !reflect.DeepEqual(hits, expected) {
+		t.Errorf("SearchByURL = %+v, wanted %+v", hits, expected)
+	}
+}
+
+func TestParseDiscussionURL(t *testing.T) {
+	tests := []struct {
+		URL string
+		ID  int
+	}{
+		{"https://news.ycombinator.com/item?id=25025552", 25025552},
+		{"https://news.ycombinator.com/item?id=abc", 0},
+		{"https://news.ycombinator.com/news", 0},
+		{"https://example.com/item?id=1", 0},
+	}
+	for _, test := range tests {
+		if id, _ := ParseDiscussionURL(test.URL); id != test.ID {
+			t.Errorf("ParseDiscussionURL(%q) = %d, wanted %d", test.URL, id, test.ID)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+// Package httpfixture records HTTP exchanges into a directory of JSON files
+// and replays them offline.
+package httpfixture
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Mode string
+
+const (
+	ModeRecord Mode = "record"
+	ModeReplay Mode = "replay"
+)
+
+const redacted = "REDACTED"
+
+// Transport is an http.RoundTripper that either passes requests through to
+// Base while saving every exchange into Dir (ModeRecord), or serves the
+// saved exchanges without touching the network (ModeReplay).
+//
+// Exchanges are matched by method, URL and body with credentials redacted,
+// so fixtures recorded with real credentials replay with fake ones.
+// Identical requests are numbered, so a recorded error followed by a
+// successful retry replays in the same order; once the recordings run out,
+// the last one is repeated.
+type Transport struct {
+	Mode Mode
+	Dir  string
+	Base http.RoundTripper
+	// Secrets are replaced in fixtures in addition to the credentials
+	// redacted by default (Authorization headers, Telegram bot tokens in
+	// the path, auth_token params).
+	Secrets []string
+
+	mut    sync.Mutex
+	counts map[string]int
+}
+
+// New returns a transport in the given mode, or nil if mode is empty.
+func New(mode Mode, dir string, secrets ...string) (*Transport, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case ModeRecord:
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	case ModeReplay:
+		if _, err := os.Stat(dir); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid mode %q, expected %s or %s", mode, ModeRecord, ModeReplay)
+	}
+	return &Transport{
+		Mode:    mode,
+		Dir:     dir,
+		Secrets: secrets,
+	}, nil
+}
+
+// Parse parses a "record:dir" or "replay:dir" spec.
+func Parse(spec string, secrets ...string) (*Transport, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	colon := strings.IndexByte(spec, ':')
+	if colon < 0 {
+		return nil, fmt.Errorf("invalid fixtures spec %q, expected record:dir or replay:dir", spec)
+	}
+	return New(Mode(spec[:colon]), spec[colon+1:], secrets...)
+}
+
+type fixture struct {
+	Request  fixtureRequest  `json:"request"`
+	Response fixtureResponse `json:"response"`
+}
+
+type fixtureRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+type fixtureResponse struct {
+	StatusCode int         `json:"status"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	req := fixtureRequest{
+		Method: r.Method,
+		URL:    t.Redact(r.URL.String()),
+		Body:   t.Redact(normalizeBoundary(string(body), r.Header.Get("Content-Type"))),
+	}
+	name := t.nextName(req)
+
+	if t.Mode == ModeReplay {
+		return t.replay(r, name)
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	header := resp.Header.Clone()
+	header.Del("Set-Cookie")
+	f := &fixture{
+		Request: req,
+		Response: fixtureResponse{
+			StatusCode: resp.StatusCode,
+			Header:     header,
+			Body:       t.Redact(string(respBody)),
+		},
+	}
+	raw, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(t.Dir, name), raw, 0644); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *Transport) replay(r *http.Request, name string) (*http.Response, error) {
+	raw, err := ioutil.ReadFile(filepath.Join(t.Dir, name))
+	if os.IsNotExist(err) && !strings.HasSuffix(name, "_1.json") {
+		// repeat the last recording of this request
+		raw, err = t.readLast(name)
+	}
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("httpfixture: no recording of %s %s in %s", r.Method, t.Redact(r.URL.String()), t.Dir)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var f fixture
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("httpfixture: %s: %w", name, err)
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(f.Response.StatusCode) + " " + http.StatusText(f.Response.StatusCode),
+		StatusCode:    f.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        f.Response.Header,
+		Body:          ioutil.NopCloser(strings.NewReader(f.Response.Body)),
+		ContentLength: int64(len(f.Response.Body)),
+		Request:       r,
+	}, nil
+}
+
+func (t *Transport) readLast(name string) ([]byte, error) {
+	prefix := name[:strings.LastIndexByte(name, '_')+1]
+	var raw []byte
+	err := os.ErrNotExist
+	for i := 1; ; i++ {
+		data, e := ioutil.ReadFile(filepath.Join(t.Dir, prefix+strconv.Itoa(i)+".json"))
+		if e != nil {
+			return raw, err
+		}
+		raw, err = data, nil
+	}
+}
+
+var nonWordRe = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// nextName returns the file name of the next exchange of the given request,
+// like GET_v1_posts_recent_1a2b3c4d_1.json.
+func (t *Transport) nextName(req fixtureRequest) string {
+	h := sha256.Sum256([]byte(req.Method + " " + req.URL + "\n" + req.Body))
+	key := hex.EncodeToString(h[:4])
+
+	path := req.URL
+	if i := strings.Index(path, "://"); i >= 0 {
+		path = path[i+3:]
+	}
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		path = path[i:]
+	}
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	path = strings.Trim(nonWordRe.ReplaceAllString(path, "_"), "_")
+	if len(path) > 60 {
+		path = path[len(path)-60:]
+	}
+
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	if t.counts == nil {
+		t.counts = make(map[string]int)
+	}
+	t.counts[key]++
+	return fmt.Sprintf("%s_%s_%s_%d.json", req.Method, path, key, t.counts[key])
+}
+
+var (
+	botTokenRe  = regexp.MustCompile(`/bot[0-9]+:[A-Za-z0-9_-]+/`)
+	authTokenRe = regexp.MustCompile(`(auth_token=)[^&\s"]+`)
+)
+
+// Redact replaces credentials in a URL or a body.
+func (t *Transport) Redact(s string) string {
+	for _, secret := range t.Secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, redacted)
+		}
+	}
+	s = botTokenRe.ReplaceAllString(s, "/bot"+redacted+"/")
+	s = authTokenRe.ReplaceAllString(s, "${1}"+redacted)
+	return s
+}
+
+// normalizeBoundary makes multipart bodies independent of the random boundary.
+func normalizeBoundary(body, ctype string) string {
+	_, params, err := mime.ParseMediaType(ctype)
+	if err != nil || params["boundary"] == "" {
+		return body
+	}
+	return strings.ReplaceAll(body, params["boundary"], "BOUNDARY")
+}
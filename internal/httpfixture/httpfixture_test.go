@@ -0,0 +1,99 @@
+package httpfixture
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpfixture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			http.Error(w, "try again", http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"token":"s3cret"}`))
+	}))
+
+	get := func(tr http.RoundTripper, token string) (int, string) {
+		t.Helper()
+		client := &http.Client{Transport: tr}
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/bot"+token+"/sendMessage?auth_token=user:"+token, strings.NewReader(`{"chat_id":"@chan"}`))
+		req.Header.Set("Authorization", "Basic "+token)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	rec, err := New(ModeRecord, dir, "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := get(rec, "123:s3cret"); code != 502 {
+		t.Errorf("recorded status = %d, wanted 502", code)
+	}
+	if code, _ := get(rec, "123:s3cret"); code != 200 {
+		t.Errorf("recorded status = %d, wanted 200", code)
+	}
+	srv.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 2 {
+		t.Fatalf("recorded %d files, wanted 2", len(files))
+	}
+	for _, fn := range files {
+		raw, _ := ioutil.ReadFile(fn)
+		if strings.Contains(string(raw), "s3cret") {
+			t.Errorf("%s contains a secret:\n%s", fn, raw)
+		}
+	}
+
+	rep, err := New(ModeReplay, dir, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []int{502, 200, 200}
+	for i, wanted := range expected {
+		code, body := get(rep, "456:other")
+		if code != wanted {
+			t.Errorf("replay %d: status = %d, wanted %d", i+1, code, wanted)
+		}
+		if wanted == 200 && body != `{"ok":true,"token":"REDACTED"}` {
+			t.Errorf("replay %d: body = %q", i+1, body)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tr := &Transport{Secrets: []string{"hunter2"}}
+	tests := []struct {
+		Input    string
+		Expected string
+	}{
+		{"https://api.telegram.org/bot12345:AAbb-cc_d/sendMessage", "https://api.telegram.org/botREDACTED/sendMessage"},
+		{"https://api.pinboard.in/v1/posts/recent?auth_token=andrey:ABC123&count=5", "https://api.pinboard.in/v1/posts/recent?auth_token=REDACTED&count=5"},
+		{"password=hunter2", "password=REDACTED"},
+	}
+	for _, test := range tests {
+		if actual := tr.Redact(test.Input); actual != test.Expected {
+			t.Errorf("Redact(%q) = %q, wanted %q", test.Input, actual, test.Expected)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Package linkcheck verifies that links resolve, following redirects to
+// their final URLs.
+package linkcheck
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultPerHost = 2
+
+type Options struct {
+	Transport http.RoundTripper
+	// UserAgent, if set, is sent with the requests.
+	UserAgent string
+	// PerHost limits the concurrent requests to a single host.
+	PerHost int
+}
+
+type Checker struct {
+	HTTPClient *http.Client
+	UserAgent  string
+	PerHost    int
+
+	mut   sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+func NewChecker(opt Options) *Checker {
+	perHost := opt.PerHost
+	if perHost <= 0 {
+		perHost = defaultPerHost
+	}
+	return &Checker{
+		HTTPClient: &http.Client{
+			Transport: opt.Transport,
+			Timeout:   10 * time.Second,
+		},
+		UserAgent: opt.UserAgent,
+		PerHost:   perHost,
+	}
+}
+
+// Result is the outcome of checking a single link.
+type Result struct {
+	URL string
+	// FinalURL is where the redirects lead, without the tracking
+	// parameters. It equals URL if there's nothing to substitute.
+	FinalURL   string
+	StatusCode int
+	// Problem describes why the link is broken, if it is.
+	Problem string
+}
+
+func (r *Result) Redirected() bool {
+	return r.Problem == "" && r.FinalURL != r.URL
+}
+
+func (r *Result) String() string {
+	switch {
+	case r.Problem != "":
+		return r.URL + ": " + r.Problem
+	case r.Redirected():
+		return r.URL + " → " + r.FinalURL
+	default:
+		return r.URL + ": OK"
+	}
+}
+
+// Check checks the given links concurrently, returning the results in
+// the same order.
+func (c *Checker) Check(urls []string) []*Result {
+	results := make([]*Result, len(urls))
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			results[i] = c.check(u)
+		}(i, u)
+	}
+	wg.Wait()
+	return results
+}
+
+func (c *Checker) check(rawURL string) *Result {
+	result := &Result{URL: rawURL, FinalURL: rawURL}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		result.Problem = "invalid URL"
+		return result
+	}
+
+	release := c.acquire(u.Host)
+	defer release()
+
+	log.Printf("[linkcheck] HEAD %s", rawURL)
+	resp, err := c.do("HEAD", rawURL)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented || resp.StatusCode == http.StatusForbidden) {
+		// some servers don't do HEAD, or treat it as a bot
+		log.Printf("[linkcheck] GET %s", rawURL)
+		resp, err = c.do("GET", rawURL)
+	}
+	if err != nil {
+		result.Problem = describeError(err)
+		return result
+	}
+
+	result.StatusCode = resp.StatusCode
+	final := resp.Request.URL
+	switch {
+	case resp.StatusCode >= 400:
+		result.Problem = resp.Status
+	case isLoginWall(final):
+		result.Problem = "login wall at " + final.String()
+	default:
+		result.FinalURL = StripTracking(final).String()
+		if result.FinalURL == StripTracking(u).String() && !hasTracking(u) {
+			// only the way the URL is written differs
+			result.FinalURL = rawURL
+		}
+	}
+	return result
+}
+
+func (c *Checker) do(method, u string) (*http.Response, error) {
+	r, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.UserAgent != "" {
+		r.Header.Set("User-Agent", c.UserAgent)
+	}
+	resp, err := c.HTTPClient.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+	return resp, nil
+}
+
+// acquire waits for a free slot for the host, returning the func that
+// frees it.
+func (c *Checker) acquire(host string) func() {
+	c.mut.Lock()
+	if c.hosts == nil {
+		c.hosts = make(map[string]chan struct{})
+	}
+	sem := c.hosts[host]
+	if sem == nil {
+		sem = make(chan struct{}, c.PerHost)
+		c.hosts[host] = sem
+	}
+	c.mut.Unlock()
+
+	sem <- struct{}{}
+	return func() { <-sem }
+}
+
+func describeError(err error) string {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		record           tls.RecordHeaderError
+	)
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) || errors.As(err, &record) || strings.Contains(err.Error(), "tls: ") {
+		return fmt.Sprintf("TLS error: %v", err)
+	}
+	return err.Error()
+}
+
+var loginPathRe = regexp.MustCompile(`(?i)/(login|log-in|signin|sign-in|sign_in|sso|auth/[a-z]+)(/|\.|$)`)
+
+// isLoginWall tells whether the link has been redirected to a login page.
+func isLoginWall(u *url.URL) bool {
+	return loginPathRe.MatchString(u.Path) || u.Host == "accounts.google.com"
+}
+
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "dclid": true, "yclid": true, "msclkid": true,
+	"mc_cid": true, "mc_eid": true, "igshid": true, "_hsenc": true, "_hsmi": true,
+	"ref_src": true, "ref_url": true, "__twitter_impression": true,
+}
+
+func isTrackingParam(key string) bool {
+	return strings.HasPrefix(key, "utm_") || trackingParams[key]
+}
+
+func hasTracking(u *url.URL) bool {
+	for key := range u.Query() {
+		if isTrackingParam(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// StripTracking returns a copy of the URL without the utm_* and similar
+// tracking parameters.
+func StripTracking(u *url.URL) *url.URL {
+	result := *u
+	if !hasTracking(u) {
+		return &result
+	}
+	q := u.Query()
+	for key := range q {
+		if isTrackingParam(key) {
+			q.Del(key)
+		}
+	}
+	result.RawQuery = q.Encode()
+	return &result
+}
@@ -0,0 +1,108 @@
+package linkcheck
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+		case "/short":
+			http.Redirect(w, r, "/final?id=1&utm_source=feed&utm_medium=rss", http.StatusMovedPermanently)
+		case "/final":
+		case "/private":
+			http.Redirect(w, r, "/users/sign_in?return_to=/private", http.StatusFound)
+		case "/users/sign_in":
+		case "/nohead":
+			if r.Method == "HEAD" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsSrv.Close()
+
+	tests := []struct {
+		Input    string
+		Expected string
+	}{
+		{"/ok", "/ok: OK"},
+		{"/ok?utm_source=x", "/ok?utm_source=x → /ok"},
+		{"/short", "/short → /final?id=1"},
+		{"/private", "/private: login wall at /users/sign_in?return_to=/private"},
+		{"/nohead", "/nohead: OK"},
+		{"/missing", "/missing: 404 Not Found"},
+	}
+	var urls []string
+	for _, test := range tests {
+		urls = append(urls, srv.URL+test.Input)
+	}
+	urls = append(urls, tlsSrv.URL)
+
+	results := NewChecker(Options{}).Check(urls)
+	for i, test := range tests {
+		actual := strings.ReplaceAll(results[i].String(), srv.URL, "")
+		if actual != test.Expected {
+			t.Errorf("Check(%q) = %q, wanted %q", test.Input, actual, test.Expected)
+		}
+	}
+	if p := results[len(tests)].Problem; !strings.HasPrefix(p, "TLS error: ") {
+		t.Errorf("Check(self-signed) problem = %q, wanted a TLS error", p)
+	}
+}
+
+func TestCheckPerHost(t *testing.T) {
+	var mut sync.Mutex
+	var active, maxActive int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mut.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mut.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mut.Lock()
+		active--
+		mut.Unlock()
+	}))
+	defer srv.Close()
+
+	var urls []string
+	for i := 0; i < 6; i++ {
+		urls = append(urls, srv.URL+"/"+string(rune('a'+i)))
+	}
+	NewChecker(Options{PerHost: 2}).Check(urls)
+	if maxActive > 2 {
+		t.Errorf("max concurrent requests = %d, wanted 2", maxActive)
+	}
+}
+
+func TestStripTracking(t *testing.T) {
+	tests := []struct {
+		Input    string
+		Expected string
+	}{
+		{"https://example.com/a", "https://example.com/a"},
+		{"https://example.com/a?utm_source=hn&utm_campaign=x", "https://example.com/a"},
+		{"https://example.com/a?id=1&fbclid=abc", "https://example.com/a?id=1"},
+		{"https://example.com/a?ref=main", "https://example.com/a?ref=main"},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse(test.Input)
+		actual := StripTracking(u).String()
+		if actual != test.Expected {
+			t.Errorf("StripTracking(%q) = %q, wanted %q", test.Input, actual, test.Expected)
+		}
+	}
+}
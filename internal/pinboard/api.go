@@ -0,0 +1,194 @@
+package pinboard
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dateFormat = "2006-01-02"
+
+// Recent returns the most recent bookmarks, optionally filtered by tag.
+// The API docs ask to call it at most once a minute.
+func (c *Client) Recent(req RecentRequest) ([]*Post, error) {
+	params := make(url.Values)
+	if req.Tag != "" {
+		params.Set("tag", req.Tag)
+	}
+	if req.Limit != 0 {
+		params.Set("count", strconv.Itoa(req.Limit))
+	}
+
+	var resp postsResponse
+	if err := c.Call("posts/recent", params, &resp); err != nil {
+		return nil, err
+	}
+	return mapPosts(resp.Posts), nil
+}
+
+type GetRequest struct {
+	// Tags filter the bookmarks, up to three
+	Tags []string
+	// Date picks the bookmarks saved on this day; defaults to the most
+	// recent day with bookmarks
+	Date time.Time
+	URL  string
+}
+
+// Get returns the bookmarks for a single date, or the one with a given URL.
+func (c *Client) Get(req GetRequest) ([]*Post, error) {
+	params := make(url.Values)
+	if len(req.Tags) > 0 {
+		params.Set("tag", strings.Join(req.Tags, " "))
+	}
+	if !req.Date.IsZero() {
+		params.Set("dt", req.Date.Format(dateFormat))
+	}
+	if req.URL != "" {
+		params.Set("url", req.URL)
+	}
+
+	var resp postsResponse
+	if err := c.Call("posts/get", params, &resp); err != nil {
+		return nil, err
+	}
+	return mapPosts(resp.Posts), nil
+}
+
+// Lookup returns the bookmark of the given URL, or nil if there is none.
+func (c *Client) Lookup(u string) (*Post, error) {
+	posts, err := c.Get(GetRequest{URL: u})
+	if err != nil || len(posts) == 0 {
+		return nil, err
+	}
+	return posts[0], nil
+}
+
+type AllRequest struct {
+	Tags []string
+	// Start is the offset and Results the maximum number of bookmarks
+	// (0 means all)
+	Start   int
+	Results int
+	// FromTime and ToTime limit the bookmarks by creation time
+	FromTime time.Time
+	ToTime   time.Time
+}
+
+// All returns all bookmarks, optionally filtered. The API docs ask to call
+// it at most once every five minutes.
+func (c *Client) All(req AllRequest) ([]*Post, error) {
+	params := make(url.Values)
+	if len(req.Tags) > 0 {
+		params.Set("tag", strings.Join(req.Tags, " "))
+	}
+	if req.Start > 0 {
+		params.Set("start", strconv.Itoa(req.Start))
+	}
+	if req.Results > 0 {
+		params.Set("results", strconv.Itoa(req.Results))
+	}
+	if !req.FromTime.IsZero() {
+		params.Set("fromdt", req.FromTime.UTC().Format(time.RFC3339))
+	}
+	if !req.ToTime.IsZero() {
+		params.Set("todt", req.ToTime.UTC().Format(time.RFC3339))
+	}
+
+	var resp postsResponse
+	if err := c.Call("posts/all", params, &resp); err != nil {
+		return nil, err
+	}
+	return mapPosts(resp.Posts), nil
+}
+
+// Add saves a bookmark. Unless replace is true, adding a URL that is
+// already bookmarked fails.
+func (c *Client) Add(post *Post, replace bool) error {
+	title := post.Title
+	if title == "" {
+		title = post.URL
+	}
+	params := url.Values{
+		"url":         []string{post.URL},
+		"description": []string{title},
+		"extended":    []string{post.Description},
+		"tags":        []string{strings.Join(post.Tags, " ")},
+		"replace":     []string{yesNo[replace]},
+		"shared":      []string{yesNo[!post.Private]},
+		"toread":      []string{yesNo[post.ToRead]},
+	}
+	if !post.Time.IsZero() {
+		params.Set("dt", post.Time.UTC().Format(time.RFC3339))
+	}
+	return c.Call("posts/add", params, &resultResponse{})
+}
+
+// Delete removes the bookmark of the given URL.
+func (c *Client) Delete(u string) error {
+	return c.Call("posts/delete", url.Values{"url": []string{u}}, &resultResponse{})
+}
+
+// LastUpdate returns the time of the most recent change to any bookmark,
+// which is a cheap way to find out whether a sync is needed.
+func (c *Client) LastUpdate() (time.Time, error) {
+	var resp struct {
+		Time time.Time `xml:"time,attr"`
+	}
+	err := c.Call("posts/update", nil, &resp)
+	return resp.Time, err
+}
+
+// Dates returns the number of bookmarks per day ("2006-01-02"),
+// optionally filtered by tags.
+func (c *Client) Dates(tags ...string) (map[string]int, error) {
+	params := make(url.Values)
+	if len(tags) > 0 {
+		params.Set("tag", strings.Join(tags, " "))
+	}
+
+	var resp struct {
+		Dates []struct {
+			Date  string `xml:"date,attr"`
+			Count int    `xml:"count,attr"`
+		} `xml:"date"`
+	}
+	if err := c.Call("posts/dates", params, &resp); err != nil {
+		return nil, err
+	}
+	result := make(map[string]int, len(resp.Dates))
+	for _, d := range resp.Dates {
+		result[d.Date] = d.Count
+	}
+	return result, nil
+}
+
+// Tags returns all tags with the number of bookmarks having each.
+func (c *Client) Tags() (map[string]int, error) {
+	var resp struct {
+		Tags []struct {
+			Tag   string `xml:"tag,attr"`
+			Count int    `xml:"count,attr"`
+		} `xml:"tag"`
+	}
+	if err := c.Call("tags/get", nil, &resp); err != nil {
+		return nil, err
+	}
+	result := make(map[string]int, len(resp.Tags))
+	for _, t := range resp.Tags {
+		result[t.Tag] = t.Count
+	}
+	return result, nil
+}
+
+// RenameTag renames a tag on all bookmarks (also merging it into an
+// existing tag).
+func (c *Client) RenameTag(old, new string) error {
+	return c.Call("tags/rename", url.Values{"old": []string{old}, "new": []string{new}}, &resultResponse{})
+}
+
+// DeleteTag removes a tag from all bookmarks.
+func (c *Client) DeleteTag(tag string) error {
+	return c.Call("tags/delete", url.Values{"tag": []string{tag}}, &resultResponse{})
+}
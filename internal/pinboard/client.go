@@ -0,0 +1,193 @@
+package pinboard
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	httpsimp "github.com/andreyvit/httpsimplified/v2"
+
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/curlstr"
+)
+
+const (
+	defaultBaseURL    = "https://api.pinboard.in/v1"
+	defaultMaxRetries = 3
+	maxBackoff        = 5 * time.Minute
+
+	// DefaultInterval is the minimum delay between calls recommended by
+	// the API docs; it is also the initial backoff after a 429 response.
+	DefaultInterval = 3 * time.Second
+)
+
+// Client calls Pinboard API v1 methods, spacing out the calls and retrying
+// after rate limiting and other transient failures.
+type Client struct {
+	HTTPClient  *http.Client
+	BaseURL     string
+	Credentials Credentials
+
+	// Interval is the minimum delay between the starts of two calls.
+	Interval time.Duration
+	// MaxRetries is the number of extra attempts after a transient failure
+	// (a network error, a 5xx response or a 429 response).
+	MaxRetries int
+
+	mut      sync.Mutex
+	lastCall time.Time
+	sleep    func(time.Duration)
+	now      func() time.Time
+}
+
+func NewClient(opt Options) *Client {
+	return &Client{
+		HTTPClient: &http.Client{
+			Transport: opt.Transport,
+			Timeout:   30 * time.Second,
+		},
+		BaseURL:     opt.BaseURL,
+		Credentials: opt.Credentials,
+		Interval:    DefaultInterval,
+		MaxRetries:  defaultMaxRetries,
+	}
+}
+
+// Call invokes the given API method (like "posts/get") and decodes the XML
+// response into result.
+func (c *Client) Call(method string, params url.Values, result interface{}) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	interval := c.Interval
+	for attempt := 0; ; attempt++ {
+		r := httpsimp.MakeGet(c.baseURL(), "/"+method, params, http.Header{})
+		c.Credentials.authorize(r)
+		if attempt == 0 {
+			log.Printf("[pinboard] %s", curlstr.CurlString(r))
+		}
+
+		c.throttle(interval)
+		err := c.do(method, r, result)
+		if err == nil || attempt >= c.MaxRetries || !isTransient(err) {
+			return err
+		}
+
+		// Pinboard asks to back off more and more after each 429
+		interval = c.Interval << uint(attempt+1)
+		if interval > maxBackoff {
+			interval = maxBackoff
+		}
+		log.Printf("[pinboard] %s failed, retrying in %v: %v", method, interval, err)
+	}
+}
+
+// throttle waits until at least d has passed since the start of the last call.
+func (c *Client) throttle(d time.Duration) {
+	now := c.doNow()
+	if !c.lastCall.IsZero() {
+		if wait := c.lastCall.Add(d).Sub(now); wait > 0 {
+			c.doSleep(wait)
+			now = now.Add(wait)
+		}
+	}
+	c.lastCall = now
+}
+
+func (c *Client) do(method string, r *http.Request, result interface{}) error {
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(r)
+	if err != nil {
+		// *url.Error includes the URL, and so the auth_token
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return &networkError{method, err}
+	}
+	defer resp.Body.Close()
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return &networkError{method, err}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return &Error{
+			Method:     method,
+			StatusCode: resp.StatusCode,
+			Message:    errorMessage(raw, resp.Status),
+		}
+	}
+
+	if rr, ok := result.(*resultResponse); ok {
+		if err := xml.Unmarshal(raw, rr); err != nil {
+			return fmt.Errorf("pinboard %s: cannot decode response: %w", method, err)
+		}
+		if code := rr.code(); code != "done" {
+			return &Error{
+				Method:     method,
+				StatusCode: resp.StatusCode,
+				Message:    code,
+			}
+		}
+	} else if result != nil {
+		if err := xml.Unmarshal(raw, result); err != nil {
+			return fmt.Errorf("pinboard %s: cannot decode response: %w", method, err)
+		}
+	}
+	return nil
+}
+
+// errorMessage extracts the result code from an XML error response, if any.
+func errorMessage(raw []byte, status string) string {
+	var rr resultResponse
+	if xml.Unmarshal(raw, &rr) == nil && rr.code() != "" {
+		return rr.code()
+	}
+	return status
+}
+
+func (c *Client) baseURL() string {
+	if c.BaseURL == "" {
+		return defaultBaseURL
+	}
+	return c.BaseURL
+}
+
+func (c *Client) doSleep(d time.Duration) {
+	if c.sleep != nil {
+		c.sleep(d)
+	} else {
+		time.Sleep(d)
+	}
+}
+
+func (c *Client) doNow() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// resultResponse is what modifying calls return: <result code="done"/>,
+// or <result>done</result> for the tags/ methods.
+type resultResponse struct {
+	Code string `xml:"code,attr"`
+	Text string `xml:",chardata"`
+}
+
+func (rr *resultResponse) code() string {
+	if rr.Code != "" {
+		return rr.Code
+	}
+	return strings.TrimSpace(rr.Text)
+}
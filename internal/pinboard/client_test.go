@@ -0,0 +1,143 @@
+package pinboard
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeResponse struct {
+	Status int
+	Body   string
+}
+
+func newTestClient(t *testing.T, responses ...fakeResponse) (*Client, *[]*http.Request, *[]time.Duration) {
+	var requests []*http.Request
+	var sleeps []time.Duration
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if len(requests) > len(responses) {
+			t.Errorf("unexpected request #%d to %s", len(requests), r.URL.Path)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		resp := responses[len(requests)-1]
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(resp.Status)
+		w.Write([]byte(resp.Body))
+	}))
+	t.Cleanup(srv.Close)
+
+	c := NewClient(Options{Credentials: Credentials{APIToken: "andrey:SECRET"}})
+	c.HTTPClient = srv.Client()
+	c.BaseURL = srv.URL
+	now := time.Date(2020, 11, 9, 16, 0, 0, 0, time.UTC)
+	c.now = func() time.Time {
+		return now
+	}
+	c.sleep = func(d time.Duration) {
+		sleeps = append(sleeps, d)
+		now = now.Add(d)
+	}
+	return c, &requests, &sleeps
+}
+
+const donePayload = `<?xml version="1.0" encoding="UTF-8" ?><result code="done" />`
+
+func TestClientAuthTokenAndThrottling(t *testing.T) {
+	c, requests, sleeps := newTestClient(t,
+		fakeResponse{200, `<?xml version="1.0" encoding="UTF-8" ?><tags><tag count="3" tag="ytn" /><tag count="1" tag="go" /></tags>`},
+		fakeResponse{200, `<?xml version="1.0" encoding="UTF-8" ?><result>done</result>`},
+	)
+
+	tags, err := c.Tags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]int{"ytn": 3, "go": 1}; !reflect.DeepEqual(tags, expected) {
+		t.Errorf("Tags() = %v, wanted %v", tags, expected)
+	}
+	if err := c.RenameTag("go", "golang"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := (*requests)[1]
+	if r.URL.Path != "/tags/rename" || r.URL.Query().Get("auth_token") != "andrey:SECRET" || r.URL.Query().Get("new") != "golang" {
+		t.Errorf("request = %s, wanted /tags/rename with auth_token", r.URL)
+	}
+	if r.Header.Get("Authorization") != "" {
+		t.Errorf("Authorization header sent along with auth_token")
+	}
+	if expected := []time.Duration{DefaultInterval}; !reflect.DeepEqual(*sleeps, expected) {
+		t.Errorf("sleeps = %v, wanted %v", *sleeps, expected)
+	}
+}
+
+func TestClientRetriesTooManyRequests(t *testing.T) {
+	c, requests, sleeps := newTestClient(t,
+		fakeResponse{429, "Too Many Requests"},
+		fakeResponse{503, "Service Unavailable"},
+		fakeResponse{200, donePayload},
+	)
+
+	if err := c.Add(&Post{URL: "https://example.com/", Tags: TagList{"a", "b"}, Private: true}, true); err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 3 {
+		t.Errorf("made %d requests, wanted 3", len(*requests))
+	}
+	q := (*requests)[2].URL.Query()
+	if q.Get("tags") != "a b" || q.Get("replace") != "yes" || q.Get("description") != "https://example.com/" || q.Get("shared") != "no" || q.Get("toread") != "no" {
+		t.Errorf("posts/add params = %v", q)
+	}
+	if expected := []time.Duration{2 * DefaultInterval, 4 * DefaultInterval}; !reflect.DeepEqual(*sleeps, expected) {
+		t.Errorf("sleeps = %v, wanted %v", *sleeps, expected)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	c, _, _ := newTestClient(t,
+		fakeResponse{200, `<?xml version="1.0" encoding="UTF-8" ?><result code="item not found" />`},
+		fakeResponse{401, "401 Forbidden"},
+	)
+
+	err := c.Delete("https://example.com/missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete error = %v, wanted ErrNotFound", err)
+	}
+	_, err = c.Recent(RecentRequest{})
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Recent error = %v, wanted ErrUnauthorized", err)
+	}
+}
+
+func TestClientNetworkErrorHidesToken(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	c := NewClient(Options{Credentials: Credentials{APIToken: "andrey:SECRET"}})
+	c.BaseURL = srv.URL
+	c.Interval = 0
+	c.sleep = func(d time.Duration) {}
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	_, err := c.Recent(RecentRequest{})
+	if err == nil {
+		t.Fatal("Recent succeeded, wanted an error")
+	}
+	if strings.Contains(err.Error(), "SECRET") {
+		t.Errorf("err = %q, wanted no auth token", err.Error())
+	}
+	if strings.Contains(logged.String(), "SECRET") {
+		t.Errorf("logged %q, wanted no auth token", logged.String())
+	}
+}
@@ -0,0 +1,67 @@
+package pinboard
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrTooManyRequests = errors.New("too many requests")
+	ErrNotFound        = errors.New("item not found")
+	ErrFailed          = errors.New("failed")
+)
+
+// Error is a failed API call: either an HTTP error status or a result code
+// other than "done". It matches ErrUnauthorized, ErrTooManyRequests,
+// ErrNotFound or ErrFailed via errors.Is.
+type Error struct {
+	Method     string
+	StatusCode int
+	// Message is the result code (like "item not found") or the HTTP status.
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("pinboard %s: %s", e.Method, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrTooManyRequests
+	case e.StatusCode == http.StatusNotFound || e.Message == "item not found":
+		return ErrNotFound
+	case e.StatusCode == http.StatusOK:
+		return ErrFailed
+	default:
+		return nil
+	}
+}
+
+type networkError struct {
+	Method string
+	Err    error
+}
+
+func (e *networkError) Error() string {
+	return fmt.Sprintf("pinboard %s: %v", e.Method, e.Err)
+}
+
+func (e *networkError) Unwrap() error {
+	return e.Err
+}
+
+func isTransient(err error) bool {
+	switch e := err.(type) {
+	case *networkError:
+		return true
+	case *Error:
+		return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+	default:
+		return false
+	}
+}
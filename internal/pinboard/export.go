@@ -0,0 +1,123 @@
+package pinboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseExport parses bookmarks in any of the formats Pinboard exports:
+// the XML of the API (also produced by the XML export), the JSON export,
+// or the Netscape bookmark HTML that browsers use too.
+func ParseExport(data []byte) ([]*Post, error) {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		return ParseJSONExport(data)
+	case isNetscapeHTML(trimmed):
+		return ParseNetscapeHTML(data)
+	default:
+		return ParseXML(data)
+	}
+}
+
+// ParseXML parses the response of posts/recent or posts/all.
+func ParseXML(data []byte) ([]*Post, error) {
+	var resp postsResponse
+	if err := xml.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	return mapPosts(resp.Posts), nil
+}
+
+type jsonPostPayload struct {
+	URL         string    `json:"href"`
+	Title       string    `json:"description"`
+	Description string    `json:"extended"`
+	Time        time.Time `json:"time"`
+	Tags        string    `json:"tags"`
+	Shared      string    `json:"shared"`
+	ToRead      string    `json:"toread"`
+}
+
+// ParseJSONExport parses the JSON export (same as posts/all?format=json).
+func ParseJSONExport(data []byte) ([]*Post, error) {
+	var pps []jsonPostPayload
+	if err := json.Unmarshal(data, &pps); err != nil {
+		return nil, err
+	}
+	var posts []*Post
+	for _, pp := range pps {
+		posts = append(posts, &Post{
+			URL:         pp.URL,
+			Title:       pp.Title,
+			Time:        pp.Time,
+			Tags:        mapTags(pp.Tags),
+			Description: pp.Description,
+			Private:     pp.Shared == "no",
+			ToRead:      pp.ToRead == "yes",
+		})
+	}
+	return posts, nil
+}
+
+var (
+	netscapeDoctypeRe = regexp.MustCompile(`(?i)^<!DOCTYPE\s+NETSCAPE-Bookmark-file`)
+	netscapeDTRe      = regexp.MustCompile(`(?i)<DT>`)
+	netscapeLinkRe    = regexp.MustCompile(`(?is)^\s*<A\s([^>]*)>(.*?)</A>(?:\s*<DD>(.*?)(?:</?DL>|<H3|</BODY>|$))?`)
+	htmlAttrRe        = regexp.MustCompile(`(?s)([A-Za-z_-]+)\s*=\s*"([^"]*)"`)
+)
+
+func isNetscapeHTML(data []byte) bool {
+	return netscapeDoctypeRe.Match(data)
+}
+
+// ParseNetscapeHTML parses the bookmark file format exported by browsers
+// and by Pinboard. Tags come from the TAGS attribute (comma-separated),
+// the time from ADD_DATE (Unix seconds), the description from <DD> and
+// the flags from PRIVATE and TOREAD.
+func ParseNetscapeHTML(data []byte) ([]*Post, error) {
+	if !isNetscapeHTML(bytes.TrimSpace(data)) {
+		return nil, fmt.Errorf("not a Netscape bookmark file")
+	}
+
+	var posts []*Post
+	for _, item := range netscapeDTRe.Split(string(data), -1)[1:] {
+		m := netscapeLinkRe.FindStringSubmatch(item)
+		if m == nil {
+			continue // a folder
+		}
+
+		attrs := make(map[string]string)
+		for _, am := range htmlAttrRe.FindAllStringSubmatch(m[1], -1) {
+			attrs[strings.ToUpper(am[1])] = html.UnescapeString(am[2])
+		}
+		if attrs["HREF"] == "" {
+			continue
+		}
+
+		post := &Post{
+			URL:         attrs["HREF"],
+			Title:       strings.TrimSpace(html.UnescapeString(m[2])),
+			Description: strings.TrimSpace(html.UnescapeString(m[3])),
+			Private:     attrs["PRIVATE"] == "1",
+			ToRead:      attrs["TOREAD"] == "1",
+		}
+		if sec, err := strconv.ParseInt(attrs["ADD_DATE"], 10, 64); err == nil {
+			post.Time = time.Unix(sec, 0).UTC()
+		}
+		for _, tag := range strings.Split(attrs["TAGS"], ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				post.Tags = append(post.Tags, tag)
+			}
+		}
+		posts = append(posts, post)
+	}
+	return posts, nil
+}
@@ -0,0 +1,66 @@
+package pinboard
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseExport(t *testing.T) {
+	expected := []*Post{
+		{
+			URL:         "https://github.com/sq5bpf/etherify",
+			Title:       "sq5bpf/etherify: Etherify - bringing the ether back to ethernet",
+			Time:        time.Date(2020, 11, 9, 16, 22, 13, 0, time.UTC),
+			Tags:        TagList{"ytn", "ytn-fun"},
+			Description: "> Morse code & ethernet.\n\nhttps://news.ycombinator.com/item?id=25025552",
+		},
+		{
+			URL:     "https://example.com/",
+			Title:   "Example",
+			Time:    time.Date(2020, 11, 4, 12, 31, 49, 0, time.UTC),
+			Private: true,
+			ToRead:  true,
+		},
+	}
+
+	tests := []struct {
+		Name  string
+		Input string
+	}{
+		{"XML", `<?xml version="1.0" encoding="UTF-8" ?>
+<posts user="andreyvit">
+  <post href="https://github.com/sq5bpf/etherify" time="2020-11-09T16:22:13Z" description="sq5bpf/etherify: Etherify - bringing the ether back to ethernet" extended="&gt; Morse code &amp; ethernet.&#10;&#10;https://news.ycombinator.com/item?id=25025552" tag="ytn ytn-fun" hash="a82033dcc01713c097c2bc97e901e339" />
+  <post href="https://example.com/" time="2020-11-04T12:31:49Z" description="Example" extended="" tag="" shared="no" toread="yes" />
+</posts>`},
+		{"JSON", `[
+{"href":"https:\/\/github.com\/sq5bpf\/etherify","description":"sq5bpf\/etherify: Etherify - bringing the ether back to ethernet","extended":"> Morse code & ethernet.\n\nhttps:\/\/news.ycombinator.com\/item?id=25025552","meta":"x","hash":"a82033dcc01713c097c2bc97e901e339","time":"2020-11-09T16:22:13Z","shared":"yes","toread":"no","tags":"ytn ytn-fun"},
+{"href":"https:\/\/example.com\/","description":"Example","extended":"","meta":"y","hash":"z","time":"2020-11-04T12:31:49Z","shared":"no","toread":"yes","tags":""}
+]`},
+		{"HTML", `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Pinboard Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+<DT><H3>Folder</H3>
+<DT><A HREF="https://github.com/sq5bpf/etherify" ADD_DATE="1604938933" PRIVATE="0" TOREAD="0" TAGS="ytn,ytn-fun">sq5bpf/etherify: Etherify - bringing the ether back to ethernet</A>
+<DD>&gt; Morse code &amp; ethernet.
+
+https://news.ycombinator.com/item?id=25025552
+<DT><A HREF="https://example.com/" ADD_DATE="1604493109" PRIVATE="1" TOREAD="1" TAGS="">Example</A>
+</DL></p>`},
+	}
+	for _, test := range tests {
+		actual, err := ParseExport([]byte(test.Input))
+		if err != nil {
+			t.Errorf("ParseExport(%s) failed: %v", test.Name, err)
+			continue
+		}
+		for _, p := range actual {
+			p.Time = p.Time.UTC()
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("ParseExport(%s) = %+v, wanted %+v", test.Name, actual, expected)
+		}
+	}
+}
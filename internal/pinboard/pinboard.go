@@ -1,34 +1,38 @@
 package pinboard
 
 import (
-	"encoding/xml"
-	"log"
 	"net/http"
-	"net/url"
-	"reflect"
-	"strconv"
 	"strings"
 	"time"
 
 	httpsimp "github.com/andreyvit/httpsimplified/v2"
-
-	"github.com/andreyvit/yesterdaytechnewsbot/internal/curlstr"
 )
 
+// Credentials authenticate with an API token ("user:HEX", see the password
+// settings page) if set, or with the username and password otherwise.
 type Credentials struct {
 	Username string
 	Password string
+	APIToken string
 }
 
-func (cred Credentials) authHeaders() http.Header {
-	return http.Header{
-		httpsimp.AuthorizationHeader: []string{httpsimp.BasicAuthValue(cred.Username, cred.Password)},
+func (cred Credentials) authorize(r *http.Request) {
+	if cred.APIToken != "" {
+		q := r.URL.Query()
+		q.Set("auth_token", cred.APIToken)
+		r.URL.RawQuery = q.Encode()
+	} else {
+		r.Header.Set(httpsimp.AuthorizationHeader, httpsimp.BasicAuthValue(cred.Username, cred.Password))
 	}
 }
 
 type Options struct {
 	Credentials
-	MockData []byte
+	// Transport, if set, is used instead of http.DefaultTransport,
+	// e.g. to record or replay fixtures.
+	Transport http.RoundTripper
+	// BaseURL overrides the API endpoint, e.g. to use a fake server.
+	BaseURL string
 }
 
 type TagList []string
@@ -64,6 +68,9 @@ type Post struct {
 	Time        time.Time
 	Tags        TagList
 	Description string
+	// Private is the opposite of Pinboard's "shared" flag.
+	Private bool
+	ToRead  bool
 }
 
 func (p *Post) TitleOrURL() string {
@@ -85,6 +92,10 @@ func (p *Post) String() string {
 		buf.WriteString(s)
 		buf.WriteByte('\n')
 	}
+	if s := p.Flags(); s != "" {
+		buf.WriteString(s)
+		buf.WriteByte('\n')
+	}
 	if p.Description != "" {
 		buf.WriteByte('\n')
 		buf.WriteString(strings.TrimSpace(p.Description))
@@ -93,47 +104,29 @@ func (p *Post) String() string {
 	return buf.String()
 }
 
-const (
-	baseURL = "https://api.pinboard.in/v1"
-)
-
-type RecentRequest struct {
-	Tag   string
-	Limit int
+// Flags describes the private and to-read flags, if set.
+func (p *Post) Flags() string {
+	return FormatFlags(p.Private, p.ToRead)
 }
 
-func LoadRecent(req RecentRequest, opt Options) ([]*Post, error) {
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+func FormatFlags(private, toRead bool) string {
+	var flags []string
+	if private {
+		flags = append(flags, "[private]")
 	}
-
-	params := make(url.Values)
-	if req.Tag != "" {
-		params.Set("tag", req.Tag)
+	if toRead {
+		flags = append(flags, "[to read]")
 	}
-	if req.Limit != 0 {
-		params.Set("count", strconv.Itoa(req.Limit))
-	}
-
-	r := httpsimp.MakeGet(baseURL, "/posts/recent", params, opt.authHeaders())
-
-	log.Printf("[pinboard] %s", curlstr.CurlString(r))
+	return strings.Join(flags, " ")
+}
 
-	var resp postsResponse
-	if opt.MockData != nil {
-		err := xml.Unmarshal(opt.MockData, &resp)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		err := httpsimp.Do(r, client, XML(&resp))
-		if err != nil {
-			return nil, err
-		}
-	}
-	return mapPosts(resp.Posts), nil
+type RecentRequest struct {
+	Tag   string
+	Limit int
 }
 
+var yesNo = map[bool]string{false: "no", true: "yes"}
+
 func mapPosts(pps []postPayload) []*Post {
 	var posts []*Post
 	for _, pp := range pps {
@@ -149,6 +142,8 @@ func mapPost(pp postPayload) *Post {
 		Time:        pp.Time,
 		Tags:        mapTags(pp.Tags),
 		Description: pp.Description,
+		Private:     pp.Shared == "no",
+		ToRead:      pp.ToRead == "yes",
 	}
 }
 
@@ -173,24 +168,6 @@ type postPayload struct {
 	Time        time.Time `xml:"time,attr"`
 	Tags        string    `xml:"tag,attr"`
 	Description string    `xml:"extended,attr"`
-}
-
-/*
-JSON is a Parser function that verifies the response status code and content
-type (which must be ContentTypeJSON) and unmarshals the body into the
-result variable (which can be anything that you'd pass to json.Unmarshal).
-
-Pass the result of this function into Do or Parse to handle a response.
-*/
-func XML(result interface{}, mopt ...httpsimp.ParseOption) httpsimp.Parser {
-	if result == nil {
-		var body interface{}
-		result = &body
-	}
-	return httpsimp.MakeParser("text/xml", mopt, func(resp *http.Response) (interface{}, error) {
-		defer resp.Body.Close()
-		err := xml.NewDecoder(resp.Body).Decode(result)
-		body := reflect.ValueOf(result).Elem().Interface()
-		return body, err
-	})
+	Shared      string    `xml:"shared,attr"`
+	ToRead      string    `xml:"toread,attr"`
 }
@@ -0,0 +1,218 @@
+package telegram
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	httpsimp "github.com/andreyvit/httpsimplified/v2"
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/curlstr"
+)
+
+const (
+	defaultBaseURL    = "https://api.telegram.org"
+	defaultMaxRetries = 3
+	defaultBackoff    = time.Second
+	maxBackoff        = 30 * time.Second
+)
+
+// Client calls Telegram Bot API methods, retrying transient failures.
+type Client struct {
+	HTTPClient *http.Client
+	BaseURL    string
+	BotToken   string
+	DryMode    bool
+
+	// MaxRetries is the number of extra attempts after a transient failure
+	// (a network error, a 5xx response or a 429 response). Methods like
+	// sendMessage aren't retried after a network error that might have
+	// happened after the request was sent, to avoid duplicate posts.
+	MaxRetries int
+	// Backoff is the delay before the first retry, doubled on each next one.
+	// A 429 response's retry_after takes precedence.
+	Backoff time.Duration
+
+	sleep func(time.Duration)
+}
+
+func NewClient(opt Options) *Client {
+	return &Client{
+		HTTPClient: &http.Client{
+			Transport: opt.Transport,
+			Timeout:   20 * time.Second,
+		},
+		BaseURL:    defaultBaseURL,
+		BotToken:   opt.BotToken,
+		DryMode:    opt.DryMode,
+		MaxRetries: defaultMaxRetries,
+		Backoff:    defaultBackoff,
+	}
+}
+
+// Call invokes the given API method, sending params as a JSON object,
+// and decodes the result into result (which can be nil).
+func (c *Client) Call(method string, params map[string]interface{}, result interface{}) error {
+	return c.call(method, result, func() (*http.Request, error) {
+		return httpsimp.MakeJSON(http.MethodPost, c.baseURL(), c.methodPath(method), nil, params, nil), nil
+	})
+}
+
+// Upload invokes the given API method as a multipart request, uploading
+// the local file at filePath as fileField. Non-string params are sent
+// JSON-encoded, as the Bot API expects.
+func (c *Client) Upload(method string, params map[string]interface{}, fileField, filePath string, result interface{}) error {
+	return c.call(method, result, func() (*http.Request, error) {
+		body, ctype, err := encodeMultipart(params, fileField, filePath)
+		if err != nil {
+			return nil, err
+		}
+		return httpsimp.Make(http.MethodPost, c.baseURL(), c.methodPath(method), nil, body, http.Header{
+			"Content-Type": []string{ctype},
+		}), nil
+	})
+}
+
+func (c *Client) call(method string, result interface{}, makeRequest func() (*http.Request, error)) error {
+	for attempt := 0; ; attempt++ {
+		r, err := makeRequest()
+		if err != nil {
+			return err
+		}
+		if attempt == 0 {
+			log.Printf("[telegram] $ %s", curlstr.CurlString(r))
+		}
+
+		err = c.do(method, r, result)
+		if err == nil || attempt >= c.MaxRetries || !isTransient(err) || mayHaveBeenSent(err) && !isIdempotent(method) {
+			return err
+		}
+
+		delay := c.Backoff << uint(attempt)
+		if delay > maxBackoff {
+			delay = maxBackoff
+		}
+		if e, ok := err.(*Error); ok && e.RetryAfter > 0 {
+			delay = e.RetryAfter
+		}
+		log.Printf("[telegram] %s failed, retrying in %v: %v", method, delay, err)
+		c.doSleep(delay)
+	}
+}
+
+func (c *Client) do(method string, r *http.Request, result interface{}) error {
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(r)
+	if err != nil {
+		// *url.Error includes the URL, and so the bot token
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return &networkError{method, err, !isDialError(err)}
+	}
+	defer resp.Body.Close()
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return &networkError{method, err, true}
+	}
+
+	var payload apiResponse
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return &Error{
+			Method:      method,
+			Code:        resp.StatusCode,
+			Description: fmt.Sprintf("cannot decode response: %v", err),
+		}
+	}
+	if !payload.OK {
+		return newError(method, &payload)
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(payload.Result, result); err != nil {
+			return fmt.Errorf("telegram %s: cannot decode result: %w", method, err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) baseURL() string {
+	if c.BaseURL == "" {
+		return defaultBaseURL
+	}
+	return c.BaseURL
+}
+
+func (c *Client) methodPath(method string) string {
+	return fmt.Sprintf("/bot%s/%s", c.BotToken, method)
+}
+
+func (c *Client) doSleep(d time.Duration) {
+	if c.sleep != nil {
+		c.sleep(d)
+	} else {
+		time.Sleep(d)
+	}
+}
+
+type apiResponse struct {
+	OK          bool                `json:"ok"`
+	Result      json.RawMessage     `json:"result"`
+	ErrorCode   int                 `json:"error_code"`
+	Description string              `json:"description"`
+	Parameters  *responseParameters `json:"parameters"`
+}
+
+type responseParameters struct {
+	RetryAfter int `json:"retry_after"`
+}
+
+func encodeMultipart(params map[string]interface{}, fileField, filePath string) ([]byte, string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for k, v := range params {
+		var value string
+		if s, ok := v.(string); ok {
+			value = s
+		} else {
+			raw, err := json.Marshal(v)
+			if err != nil {
+				panic(err)
+			}
+			value = string(raw)
+		}
+		if err := w.WriteField(k, value); err != nil {
+			return nil, "", err
+		}
+	}
+	fw, err := w.CreateFormFile(fileField, filepath.Base(filePath))
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := io.Copy(fw, f); err != nil {
+		return nil, "", fmt.Errorf("reading %s: %w", filePath, err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
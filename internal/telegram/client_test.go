@@ -0,0 +1,323 @@
+package telegram
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// dropConnection as fakeResponse.Status closes the connection after
+// the request has been received.
+const dropConnection = -1
+
+type fakeResponse struct {
+	Status int
+	Body   string
+}
+
+// testRequest is a copy of what the fake server received, taken in
+// the handler so that the tests don't touch the live request.
+type testRequest struct {
+	Method string
+	Path   string
+	Body   string
+	// Form and Files hold the parts of a multipart request.
+	Form  url.Values
+	Files map[string]testFile
+}
+
+type testFile struct {
+	Name string
+	Data string
+}
+
+type requestLog struct {
+	mut      sync.Mutex
+	requests []testRequest
+}
+
+func (l *requestLog) add(r testRequest) int {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	l.requests = append(l.requests, r)
+	return len(l.requests)
+}
+
+func (l *requestLog) all() []testRequest {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	return append([]testRequest(nil), l.requests...)
+}
+
+func newTestClient(t *testing.T, responses ...fakeResponse) (*Client, *requestLog, *[]time.Duration) {
+	requests := new(requestLog)
+	var sleeps []time.Duration
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := testRequest{
+			Method: r.Method,
+			Path:   r.URL.Path,
+		}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				t.Errorf("invalid multipart request: %v", err)
+			} else {
+				req.Form = url.Values(r.MultipartForm.Value)
+				req.Files = make(map[string]testFile)
+				for name, fhs := range r.MultipartForm.File {
+					f, _ := fhs[0].Open()
+					data, _ := ioutil.ReadAll(f)
+					f.Close()
+					req.Files[name] = testFile{fhs[0].Filename, string(data)}
+				}
+			}
+		} else {
+			body, _ := ioutil.ReadAll(r.Body)
+			req.Body = string(body)
+		}
+		n := requests.add(req)
+
+		if n > len(responses) {
+			t.Errorf("unexpected request #%d to %s", n, r.URL.Path)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		resp := responses[n-1]
+		if resp.Status == dropConnection {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(resp.Status)
+		w.Write([]byte(resp.Body))
+	}))
+	t.Cleanup(srv.Close)
+
+	c := NewClient(Options{Credentials: Credentials{BotToken: "123:SECRET"}})
+	c.HTTPClient = srv.Client()
+	c.BaseURL = srv.URL
+	c.sleep = func(d time.Duration) {
+		sleeps = append(sleeps, d)
+	}
+	return c, requests, &sleeps
+}
+
+const okMessage = `{"ok":true,"result":{"message_id":42}}`
+
+func TestClientSendMessage(t *testing.T) {
+	c, requests, _ := newTestClient(t, fakeResponse{200, okMessage})
+
+	id, err := c.Send(Chat{ID: "-1001234", ThreadID: 5}, &Message{HTMLText: "<b>Hi</b>", ReplyToMessageID: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 42 {
+		t.Errorf("id = %d, wanted 42", id)
+	}
+
+	r := requests.all()[0]
+	if r.Method != http.MethodPost || r.Path != "/bot123:SECRET/sendMessage" {
+		t.Errorf("request = %s %s, wanted POST /bot123:SECRET/sendMessage", r.Method, r.Path)
+	}
+	var params map[string]interface{}
+	if err := json.Unmarshal([]byte(r.Body), &params); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if params["chat_id"] != "-1001234" || params["message_thread_id"] != float64(5) || params["text"] != "<b>Hi</b>" || params["parse_mode"] != "HTML" || params["reply_to_message_id"] != float64(7) {
+		t.Errorf("params = %v", params)
+	}
+	if lpo, ok := params["link_preview_options"].(map[string]interface{}); !ok || lpo["is_disabled"] != true {
+		t.Errorf("link_preview_options = %v, wanted a disabled preview", params["link_preview_options"])
+	}
+}
+
+func TestClientSendButtons(t *testing.T) {
+	c, requests, _ := newTestClient(t, fakeResponse{200, okMessage})
+
+	_, err := c.Send(Chat{ID: "@chan"}, &Message{MarkdownText: "Hi", Buttons: [][]InlineButton{
+		{{Text: "💬 HN", URL: "https://news.ycombinator.com/item?id=1"}, {Text: "Paper", URL: "https://arxiv.org/abs/1"}},
+		{{Text: "Publish", CallbackData: "publish"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var params struct {
+		ReplyMarkup json.RawMessage `json:"reply_markup"`
+	}
+	if err := json.Unmarshal([]byte(requests.all()[0].Body), &params); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	expected := `{"inline_keyboard":[[{"text":"💬 HN","url":"https://news.ycombinator.com/item?id=1"},{"text":"Paper","url":"https://arxiv.org/abs/1"}],[{"text":"Publish","callback_data":"publish"}]]}`
+	if actual := string(params.ReplyMarkup); actual != expected {
+		t.Errorf("reply_markup = %s, wanted %s", actual, expected)
+	}
+}
+
+func TestClientRetriesTooManyRequests(t *testing.T) {
+	c, requests, sleeps := newTestClient(t,
+		fakeResponse{429, `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 5","parameters":{"retry_after":5}}`},
+		fakeResponse{502, `<html>Bad Gateway</html>`},
+		fakeResponse{200, okMessage},
+	)
+
+	id, err := c.Send(Chat{ID: "@chan"}, &Message{MarkdownText: "Hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(requests.all()); id != 42 || n != 3 {
+		t.Errorf("id = %d after %d requests, wanted 42 after 3", id, n)
+	}
+	if len(*sleeps) != 2 || (*sleeps)[0] != 5*time.Second || (*sleeps)[1] != 2*time.Second {
+		t.Errorf("sleeps = %v, wanted [5s 2s]", *sleeps)
+	}
+}
+
+func TestClientGivesUpAfterMaxRetries(t *testing.T) {
+	tooMany := fakeResponse{429, `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 1","parameters":{"retry_after":1}}`}
+	c, requests, _ := newTestClient(t, tooMany, tooMany, tooMany, tooMany)
+
+	_, err := c.Send(Chat{ID: "@chan"}, &Message{MarkdownText: "Hi"})
+	if !errors.Is(err, ErrTooManyRequests) {
+		t.Fatalf("err = %v, wanted ErrTooManyRequests", err)
+	}
+	var e *Error
+	if !errors.As(err, &e) || e.RetryAfter != time.Second {
+		t.Errorf("err = %#v, wanted RetryAfter = 1s", err)
+	}
+	if n := len(requests.all()); n != 4 {
+		t.Errorf("made %d requests, wanted 4", n)
+	}
+}
+
+func TestClientDoesNotResendAfterDroppedConnection(t *testing.T) {
+	c, requests, _ := newTestClient(t, fakeResponse{dropConnection, ""}, fakeResponse{200, okMessage})
+
+	_, err := c.Send(Chat{ID: "@chan"}, &Message{MarkdownText: "Hi"})
+	if err == nil {
+		t.Fatal("Send succeeded, wanted an error")
+	}
+	if strings.Contains(err.Error(), "SECRET") {
+		t.Errorf("err = %q, wanted no bot token", err.Error())
+	}
+	if n := len(requests.all()); n != 1 {
+		t.Errorf("made %d requests, wanted no retries of sendMessage", n)
+	}
+}
+
+func TestClientRetriesGetUpdatesAfterDroppedConnection(t *testing.T) {
+	c, requests, _ := newTestClient(t, fakeResponse{dropConnection, ""}, fakeResponse{200, `{"ok":true,"result":[]}`})
+
+	if err := c.Call("getUpdates", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(requests.all()); n != 2 {
+		t.Errorf("made %d requests, wanted 2", n)
+	}
+}
+
+func TestClientNetworkErrorHidesToken(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	c := NewClient(Options{Credentials: Credentials{BotToken: "123:SECRET"}})
+	c.BaseURL = srv.URL
+	c.sleep = func(d time.Duration) {}
+
+	err := c.Call("getMe", nil, nil)
+	if err == nil {
+		t.Fatal("Call succeeded, wanted an error")
+	}
+	if strings.Contains(err.Error(), "SECRET") {
+		t.Errorf("err = %q, wanted no bot token", err.Error())
+	}
+}
+
+func TestClientBadRequest(t *testing.T) {
+	c, requests, _ := newTestClient(t,
+		fakeResponse{400, `{"ok":false,"error_code":400,"description":"Bad Request: can't parse entities: Character '.' is reserved and must be escaped with the preceding '\\' at byte offset 17"}`},
+	)
+
+	_, err := c.Send(Chat{ID: "@chan"}, &Message{MarkdownText: "Hello world. Bye."})
+	if !errors.Is(err, ErrBadRequest) {
+		t.Fatalf("err = %v, wanted ErrBadRequest", err)
+	}
+	var e *Error
+	if !errors.As(err, &e) || e.Offset != 17 {
+		t.Errorf("err = %#v, wanted Offset = 17", err)
+	}
+	if n := len(requests.all()); n != 1 {
+		t.Errorf("made %d requests, wanted no retries", n)
+	}
+}
+
+func TestClientForbidden(t *testing.T) {
+	c, _, _ := newTestClient(t,
+		fakeResponse{403, `{"ok":false,"error_code":403,"description":"Forbidden: bot is not a member of the channel chat"}`},
+	)
+
+	_, err := c.Send(Chat{ID: "@chan"}, &Message{MarkdownText: "Hi"})
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("err = %v, wanted ErrForbidden", err)
+	}
+}
+
+func TestClientUploadsLocalPhoto(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "diagram.png")
+	if err := ioutil.WriteFile(fn, []byte("PNGDATA"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, requests, _ := newTestClient(t, fakeResponse{200, okMessage})
+
+	_, err := c.Send(Chat{ID: "@chan"}, &Message{MarkdownText: "*Caption*", Photo: &Photo{Path: fn}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := requests.all()[0]
+	if r.Path != "/bot123:SECRET/sendPhoto" {
+		t.Errorf("path = %s, wanted sendPhoto", r.Path)
+	}
+	if v := r.Form.Get("caption"); v != "*Caption*" {
+		t.Errorf("caption = %q", v)
+	}
+	if v := r.Form.Get("parse_mode"); v != "MarkdownV2" {
+		t.Errorf("parse_mode = %q", v)
+	}
+	if f := r.Files["photo"]; f.Name != "diagram.png" || f.Data != "PNGDATA" {
+		t.Errorf("photo = %s %q", f.Name, f.Data)
+	}
+}
+
+func TestParseChat(t *testing.T) {
+	tests := []struct {
+		Input    string
+		Expected Chat
+	}{
+		{"chan", Chat{ID: "@chan"}},
+		{"@chan", Chat{ID: "@chan"}},
+		{"-1001234567890", Chat{ID: "-1001234567890"}},
+		{"-1001234567890/42", Chat{ID: "-1001234567890", ThreadID: 42}},
+	}
+	for _, test := range tests {
+		actual, err := ParseChat(test.Input)
+		if err != nil {
+			t.Errorf("ParseChat(%q) failed: %v", test.Input, err)
+		} else if actual != test.Expected {
+			t.Errorf("ParseChat(%q) = %+v, wanted %+v", test.Input, actual, test.Expected)
+		}
+	}
+
+	for _, input := range []string{"", "/42", "-100123/x", "-100123/0"} {
+		if _, err := ParseChat(input); err == nil {
+			t.Errorf("ParseChat(%q) succeeded, wanted an error", input)
+		}
+	}
+}
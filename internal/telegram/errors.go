@@ -0,0 +1,109 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrBadRequest      = errors.New("bad request")
+	ErrForbidden       = errors.New("forbidden")
+	ErrTooManyRequests = errors.New("too many requests")
+)
+
+// Error is an error response of the Bot API. It matches ErrBadRequest,
+// ErrForbidden or ErrTooManyRequests via errors.Is depending on the code.
+type Error struct {
+	Method      string
+	Code        int
+	Description string
+
+	// RetryAfter is how long to wait before repeating a rate-limited request.
+	RetryAfter time.Duration
+
+	// Offset is the byte offset of a text parsing error reported by
+	// a bad request response, or -1 if none.
+	Offset int
+}
+
+var parseErrorOffsetRe = regexp.MustCompile(`byte offset (\d+)`)
+
+func newError(method string, payload *apiResponse) *Error {
+	e := &Error{
+		Method:      method,
+		Code:        payload.ErrorCode,
+		Description: payload.Description,
+		Offset:      -1,
+	}
+	if payload.Parameters != nil && payload.Parameters.RetryAfter > 0 {
+		e.RetryAfter = time.Duration(payload.Parameters.RetryAfter) * time.Second
+	}
+	if m := parseErrorOffsetRe.FindStringSubmatch(payload.Description); m != nil {
+		e.Offset, _ = strconv.Atoi(m[1])
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("telegram %s: %d %s", e.Method, e.Code, e.Description)
+}
+
+func (e *Error) Unwrap() error {
+	switch e.Code {
+	case http.StatusBadRequest:
+		return ErrBadRequest
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusTooManyRequests:
+		return ErrTooManyRequests
+	default:
+		return nil
+	}
+}
+
+type networkError struct {
+	Method string
+	Err    error
+	// MaybeSent is true unless the connection failed to be established.
+	MaybeSent bool
+}
+
+func (e *networkError) Error() string {
+	return fmt.Sprintf("telegram %s: %v", e.Method, e.Err)
+}
+
+func (e *networkError) Unwrap() error {
+	return e.Err
+}
+
+func isTransient(err error) bool {
+	switch e := err.(type) {
+	case *networkError:
+		return true
+	case *Error:
+		return e.Code == http.StatusTooManyRequests || e.Code >= 500
+	default:
+		return false
+	}
+}
+
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func mayHaveBeenSent(err error) bool {
+	e, ok := err.(*networkError)
+	return ok && e.MaybeSent
+}
+
+// isIdempotent tells whether repeating the method has no extra effect.
+func isIdempotent(method string) bool {
+	return strings.HasPrefix(method, "get") || method == "answerCallbackQuery" || method == "pinChatMessage" || method == "editMessageText"
+}
@@ -0,0 +1,122 @@
+package telegram
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MaxMessageLength = 4096
+	MaxCaptionLength = 1024
+)
+
+// TextLength returns the length of a message as Telegram measures it against
+// its limits: in UTF-16 code units, after markup is parsed into entities.
+func TextLength(text string, mode ParseMode) int {
+	switch mode {
+	case ParseModeHTML:
+		return utf16Len(htmlPlainText(text))
+	default:
+		return utf16Len(markdownPlainText(text))
+	}
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+func markdownPlainText(s string) string {
+	var buf strings.Builder
+	lineStart := true
+	inCode := false
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			r, n := utf8.DecodeRuneInString(s[i+1:])
+			buf.WriteRune(r)
+			i += 1 + n
+		case c == '`':
+			inCode = !inCode
+			i++
+		case inCode:
+			buf.WriteByte(c)
+			i++
+		case c == '*' || c == '_' || c == '~' || c == '|' || c == '[':
+			i++
+		case c == ']' && i+1 < len(s) && s[i+1] == '(':
+			j := i + 2
+			for j < len(s) && s[j] != ')' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			i = j + 1
+		case c == '>' && lineStart:
+			i++
+		default:
+			buf.WriteByte(c)
+			i++
+		}
+		lineStart = (c == '\n')
+	}
+	return buf.String()
+}
+
+func htmlPlainText(s string) string {
+	var buf strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch c {
+		case '<':
+			if j := strings.IndexByte(s[i:], '>'); j >= 0 {
+				i += j + 1
+				continue
+			}
+		case '&':
+			if j := strings.IndexByte(s[i:], ';'); j > 1 && j < 12 {
+				if r, ok := decodeHTMLEntity(s[i+1 : i+j]); ok {
+					buf.WriteRune(r)
+					i += j + 1
+					continue
+				}
+			}
+		}
+		buf.WriteByte(c)
+		i++
+	}
+	return buf.String()
+}
+
+func decodeHTMLEntity(name string) (rune, bool) {
+	switch name {
+	case "lt":
+		return '<', true
+	case "gt":
+		return '>', true
+	case "amp":
+		return '&', true
+	case "quot":
+		return '"', true
+	}
+	if strings.HasPrefix(name, "#x") || strings.HasPrefix(name, "#X") {
+		if v, err := strconv.ParseUint(name[2:], 16, 32); err == nil {
+			return rune(v), true
+		}
+	} else if strings.HasPrefix(name, "#") {
+		if v, err := strconv.ParseUint(name[1:], 10, 32); err == nil {
+			return rune(v), true
+		}
+	}
+	return 0, false
+}
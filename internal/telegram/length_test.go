@@ -0,0 +1,31 @@
+package telegram
+
+import (
+	"testing"
+)
+
+func TestTextLength(t *testing.T) {
+	tests := []struct {
+		Text     string
+		Mode     ParseMode
+		Expected int
+	}{
+		{"Hello", ParseModeMarkdownV2, 5},
+		{"*Hello* world\\!", ParseModeMarkdownV2, 12},
+		{"[example\\.com](https://example\\.com/\\(x\\))", ParseModeMarkdownV2, 11},
+		{"\\> not a quote\n> quote", ParseModeMarkdownV2, 20},
+		{"`a*b`", ParseModeMarkdownV2, 3},
+		{"Привет 👋", ParseModeMarkdownV2, 9},
+		{"<b>Hello</b> world!", ParseModeHTML, 12},
+		{`<a href="https://example.com/?a=1&amp;b=2">link</a>`, ParseModeHTML, 4},
+		{"a &lt; b &amp;&amp; c &#62; d", ParseModeHTML, 14},
+		{"<blockquote expandable>quote</blockquote>", ParseModeHTML, 5},
+		{"AT&T", ParseModeHTML, 4},
+	}
+	for _, test := range tests {
+		actual := TextLength(test.Text, test.Mode)
+		if actual != test.Expected {
+			t.Errorf("TextLength(%q, %s) = %d, wanted %d", test.Text, test.Mode, actual, test.Expected)
+		}
+	}
+}
@@ -1,81 +1,204 @@
 package telegram
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
-	"net/url"
+	"strconv"
 	"strings"
-	"time"
-
-	httpsimp "github.com/andreyvit/httpsimplified/v2"
-	"github.com/andreyvit/yesterdaytechnewsbot/internal/curlstr"
 )
 
 type Credentials struct {
-	BotToken    string
-	ChannelName string
+	BotToken string
 }
 
 type Options struct {
 	Credentials
 	DryMode bool
+	// Transport, if set, is used instead of http.DefaultTransport,
+	// e.g. to record or replay fixtures.
+	Transport http.RoundTripper
 }
 
-type Message struct {
-	MarkdownText     string
-	EnableWebPreview bool
+// Chat is a destination to post into: a channel or group identified by
+// a numeric ID or an @username, optionally narrowed to a forum topic.
+type Chat struct {
+	ID       string
+	ThreadID int
+}
+
+// ParseChat parses a chat specification like @channel, channel, -1001234567890
+// or -1001234567890/42 (a forum topic).
+func ParseChat(s string) (Chat, error) {
+	var chat Chat
+	if i := strings.LastIndexByte(s, '/'); i >= 0 {
+		id, err := strconv.Atoi(s[i+1:])
+		if err != nil || id <= 0 {
+			return Chat{}, fmt.Errorf("invalid Telegram chat %q: bad topic ID", s)
+		}
+		chat.ThreadID = id
+		s = s[:i]
+	}
+	if s == "" {
+		return Chat{}, fmt.Errorf("invalid Telegram chat: empty chat ID")
+	}
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil || strings.HasPrefix(s, "@") {
+		chat.ID = s
+	} else {
+		chat.ID = "@" + s
+	}
+	return chat, nil
+}
+
+func (chat Chat) String() string {
+	if chat.ThreadID != 0 {
+		return fmt.Sprintf("%s/%d", chat.ID, chat.ThreadID)
+	}
+	return chat.ID
 }
 
+type ParseMode string
+
 const (
-	baseURL = "https://api.telegram.org"
+	ParseModeMarkdownV2 ParseMode = "MarkdownV2"
+	ParseModeHTML       ParseMode = "HTML"
 )
 
-var tgBool = map[bool]string{false: "0", true: "1"}
+func ParseParseMode(s string) (ParseMode, error) {
+	switch strings.ToLower(s) {
+	case "", "markdown", "markdownv2":
+		return ParseModeMarkdownV2, nil
+	case "html":
+		return ParseModeHTML, nil
+	default:
+		return "", fmt.Errorf("invalid Telegram parse mode %q, expected MarkdownV2 or HTML", s)
+	}
+}
+
+type Message struct {
+	MarkdownText     string
+	HTMLText         string
+	LinkPreview      *LinkPreviewOptions // nil disables the preview
+	ReplyToMessageID int
+	Photo            *Photo // sent via sendPhoto with the text as caption
+	Buttons          [][]InlineButton
+	// Silent sends the message without a notification.
+	Silent bool
+}
+
+// InlineButton is an inline keyboard button that either opens a link
+// or sends CallbackData back to the bot.
+type InlineButton struct {
+	Text         string `json:"text"`
+	URL          string `json:"url,omitempty"`
+	CallbackData string `json:"callback_data,omitempty"`
+}
+
+type inlineKeyboardMarkup struct {
+	InlineKeyboard [][]InlineButton `json:"inline_keyboard"`
+}
+
+// Photo is either a URL for Telegram to fetch or a local file to upload.
+type Photo struct {
+	URL  string
+	Path string
+}
+
+type LinkPreviewOptions struct {
+	IsDisabled       bool   `json:"is_disabled,omitempty"`
+	URL              string `json:"url,omitempty"`
+	PreferSmallMedia bool   `json:"prefer_small_media,omitempty"`
+	PreferLargeMedia bool   `json:"prefer_large_media,omitempty"`
+	ShowAboveText    bool   `json:"show_above_text,omitempty"`
+}
 
-func PostText(msg *Message, opt Options) error {
-	client := &http.Client{
-		Timeout: 20 * time.Second,
+// Text returns the message text along with the parse mode to send it with.
+// HTMLText takes precedence when both are set.
+func (msg *Message) Text() (string, ParseMode) {
+	if msg.HTMLText != "" {
+		return msg.HTMLText, ParseModeHTML
 	}
+	return msg.MarkdownText, ParseModeMarkdownV2
+}
 
-	r := httpsimp.MakeGet(baseURL, fmt.Sprintf("/bot%s/sendMessage", opt.BotToken), url.Values{
-		"chat_id":                  []string{"@" + opt.ChannelName},
-		"text":                     []string{msg.MarkdownText},
-		"parse_mode":               []string{"MarkdownV2"},
-		"disable_web_page_preview": []string{tgBool[!msg.EnableWebPreview]},
-	}, nil)
+type sentMessage struct {
+	MessageID int `json:"message_id"`
+}
 
-	log.Printf("[telegram] $ %s", curlstr.CurlString(r))
-	if opt.DryMode {
-		log.Printf("[telegram] dry mode for message:\n%s", indent(msg.MarkdownText))
-	} else {
-		log.Printf("[telegram] sending message:\n%s", indent(msg.MarkdownText))
+// Send posts the message to the given chat (using sendPhoto if the message
+// has a photo) and returns its ID, which is zero in dry mode.
+func (c *Client) Send(chat Chat, msg *Message) (int, error) {
+	text, parseMode := msg.Text()
 
-		var resp sendMessageResponse
-		err := httpsimp.Do(r, client, httpsimp.JSON(&resp))
-		if err != nil {
-			return err
-		}
+	params := map[string]interface{}{
+		"chat_id": chat.ID,
+	}
+	if chat.ThreadID != 0 {
+		params["message_thread_id"] = chat.ThreadID
+	}
+	if msg.ReplyToMessageID != 0 {
+		params["reply_to_message_id"] = msg.ReplyToMessageID
+	}
+	if len(msg.Buttons) > 0 {
+		params["reply_markup"] = inlineKeyboardMarkup{msg.Buttons}
+	}
+	if msg.Silent {
+		params["disable_notification"] = true
+	}
 
-		if !resp.OK {
-			data, err := json.MarshalIndent(resp, "", "  ")
-			if err != nil {
-				panic(err)
-			}
-			log.Printf("WARNING: telegram post failed: %s", data)
-			return fmt.Errorf("telegram post failed")
+	method := "sendMessage"
+	if msg.Photo != nil {
+		method = "sendPhoto"
+		if text != "" {
+			params["caption"] = text
+			params["parse_mode"] = string(parseMode)
+		}
+		if msg.Photo.Path == "" {
+			params["photo"] = msg.Photo.URL
 		}
+	} else {
+		preview := msg.LinkPreview
+		if preview == nil {
+			preview = &LinkPreviewOptions{IsDisabled: true}
+		}
+		params["text"] = text
+		params["parse_mode"] = string(parseMode)
+		params["link_preview_options"] = preview
+	}
+
+	if c.DryMode {
+		log.Printf("[telegram] dry mode for %s to %v:\n%s", method, chat, indent(text))
+		return 0, nil
 	}
+	log.Printf("[telegram] %s to %v:\n%s", method, chat, indent(text))
 
-	return nil
+	var result sentMessage
+	var err error
+	if msg.Photo != nil && msg.Photo.Path != "" {
+		err = c.Upload(method, params, "photo", msg.Photo.Path, &result)
+	} else {
+		err = c.Call(method, params, &result)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return result.MessageID, nil
 }
 
-type sendMessageResponse struct {
-	OK          bool        `json:"ok"`
-	Result      interface{} `json:"result"`
-	ErrorCode   int         `json:"error_code"`
-	Description string      `json:"description"`
+// PinChatMessage pins a message, notifying the members unless silent.
+func (c *Client) PinChatMessage(chat Chat, messageID int, silent bool) error {
+	params := map[string]interface{}{
+		"chat_id":    chat.ID,
+		"message_id": messageID,
+	}
+	if silent {
+		params["disable_notification"] = true
+	}
+	if c.DryMode {
+		log.Printf("[telegram] dry mode for pinChatMessage %d in %v", messageID, chat)
+		return nil
+	}
+	return c.Call("pinChatMessage", params, nil)
 }
 
 func Escape(s string) string {
@@ -103,6 +226,16 @@ func EscapeExceptFormatting(s string) string {
 	return s
 }
 
+// EscapeHTML escapes the characters that Telegram's HTML parse mode treats
+// specially in text and attribute values.
+func EscapeHTML(s string) string {
+	s = strings.ReplaceAll(s, "&", "&amp;")
+	s = strings.ReplaceAll(s, "<", "&lt;")
+	s = strings.ReplaceAll(s, ">", "&gt;")
+	s = strings.ReplaceAll(s, "\"", "&quot;")
+	return s
+}
+
 const indentStep = "    "
 
 func indent(s string) string {
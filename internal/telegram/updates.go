@@ -0,0 +1,114 @@
+package telegram
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PollTimeout is the longest GetUpdates can wait for new updates; it must
+// stay below the HTTP client timeout.
+const PollTimeout = 15 * time.Second
+
+type Update struct {
+	UpdateID      int              `json:"update_id"`
+	Message       *IncomingMessage `json:"message"`
+	CallbackQuery *CallbackQuery   `json:"callback_query"`
+}
+
+type User struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+}
+
+func (u *User) String() string {
+	if u.Username != "" {
+		return "@" + u.Username
+	}
+	return strconv.FormatInt(u.ID, 10)
+}
+
+type ChatInfo struct {
+	ID       int64  `json:"id"`
+	Type     string `json:"type"`
+	Username string `json:"username"`
+}
+
+// Chat returns the destination for replying into this chat.
+func (ci ChatInfo) Chat() Chat {
+	return Chat{ID: strconv.FormatInt(ci.ID, 10)}
+}
+
+// Is tells if this is the given chat, which can be specified either by ID
+// or by @username. The topic of a forum chat is not compared.
+func (ci ChatInfo) Is(chat Chat) bool {
+	if strings.HasPrefix(chat.ID, "@") {
+		return ci.Username != "" && strings.EqualFold(chat.ID[1:], ci.Username)
+	}
+	return chat.ID == strconv.FormatInt(ci.ID, 10)
+}
+
+type IncomingMessage struct {
+	MessageID int      `json:"message_id"`
+	From      *User    `json:"from"`
+	Chat      ChatInfo `json:"chat"`
+	Text      string   `json:"text"`
+}
+
+type CallbackQuery struct {
+	ID      string           `json:"id"`
+	From    User             `json:"from"`
+	Message *IncomingMessage `json:"message"`
+	Data    string           `json:"data"`
+}
+
+// GetUpdates long-polls for updates with IDs starting at offset (pass
+// the last seen ID plus one to acknowledge the earlier ones), waiting up to
+// timeout (at most PollTimeout) for new ones to arrive.
+func (c *Client) GetUpdates(offset int, timeout time.Duration) ([]*Update, error) {
+	if timeout > PollTimeout {
+		timeout = PollTimeout
+	}
+	var updates []*Update
+	err := c.Call("getUpdates", map[string]interface{}{
+		"offset":          offset,
+		"timeout":         int(timeout / time.Second),
+		"allowed_updates": []string{"message", "callback_query"},
+	}, &updates)
+	return updates, err
+}
+
+// AnswerCallbackQuery stops the button's loading indicator, optionally
+// showing a notification text.
+func (c *Client) AnswerCallbackQuery(id, text string) error {
+	params := map[string]interface{}{
+		"callback_query_id": id,
+	}
+	if text != "" {
+		params["text"] = text
+	}
+	return c.Call("answerCallbackQuery", params, nil)
+}
+
+// EditMessageText replaces the text and the inline keyboard of a message
+// sent earlier; a message without buttons removes the keyboard.
+func (c *Client) EditMessageText(chat Chat, messageID int, msg *Message) error {
+	text, parseMode := msg.Text()
+	preview := msg.LinkPreview
+	if preview == nil {
+		preview = &LinkPreviewOptions{IsDisabled: true}
+	}
+
+	params := map[string]interface{}{
+		"chat_id":              chat.ID,
+		"message_id":           messageID,
+		"text":                 text,
+		"parse_mode":           string(parseMode),
+		"link_preview_options": preview,
+	}
+	if len(msg.Buttons) > 0 {
+		params["reply_markup"] = inlineKeyboardMarkup{msg.Buttons}
+	}
+	return c.Call("editMessageText", params, nil)
+}
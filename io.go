@@ -10,14 +10,21 @@ import (
 	"github.com/eiannone/keyboard"
 )
 
-type IO struct {
+// IO asks the user to pick one of the choices, each identified by its first
+// uppercase letter; Enter picks defaultChoice and Esc picks cancelChoice.
+type IO interface {
+	Prompt(prompt string, defaultChoice, cancelChoice rune, choices ...string) rune
 }
 
-func NewIO() *IO {
-	return &IO{}
+// TerminalIO reads single key presses from the terminal.
+type TerminalIO struct {
 }
 
-func (io *IO) Prompt(prompt string, defaultChoice, cancelChoice rune, choices ...string) rune {
+func NewIO() IO {
+	return &TerminalIO{}
+}
+
+func (io *TerminalIO) Prompt(prompt string, defaultChoice, cancelChoice rune, choices ...string) rune {
 	defaultIndex := -1
 	cancelIndex := -1
 	var validRunes []rune
@@ -78,3 +85,24 @@ func (io *IO) Prompt(prompt string, defaultChoice, cancelChoice rune, choices ..
 		fmt.Fprintln(w)
 	}
 }
+
+// ScriptedIO answers prompts with predefined choices, for testing. Once the
+// answers run out, it picks cancelChoice.
+type ScriptedIO struct {
+	Answers []rune
+	// Prompts records the prompts asked so far.
+	Prompts []string
+}
+
+func (io *ScriptedIO) Prompt(prompt string, defaultChoice, cancelChoice rune, choices ...string) rune {
+	io.Prompts = append(io.Prompts, prompt)
+	if len(io.Answers) == 0 {
+		return cancelChoice
+	}
+	r := io.Answers[0]
+	io.Answers = io.Answers[1:]
+	if r == '\n' {
+		return defaultChoice
+	}
+	return r
+}
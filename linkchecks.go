@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/linkcheck"
+)
+
+// LinkCheckOptions configure verifying the links of a post before review.
+type LinkCheckOptions struct {
+	linkcheck.Options
+	Enabled bool
+}
+
+// checkLinks checks the post URL and the trailing links.
+func (env *Env) checkLinks(post *Post) []*linkcheck.Result {
+	if !env.Conf.LinkCheck.Enabled {
+		return nil
+	}
+	return env.LinkCheck.Check(postURLs(post))
+}
+
+// postURLs lists the post URL followed by the trailing links, without
+// duplicates.
+func postURLs(post *Post) []string {
+	urls := []string{post.URL}
+	seen := map[string]bool{post.URL: true}
+	keys := make([]string, 0, len(post.Links))
+	for key := range post.Links {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if u := post.Links[key]; !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// brokenLinks describes the links that don't resolve, like "...: 404 Not Found".
+func (pending *pendingPost) brokenLinks() []string {
+	var result []string
+	for _, r := range pending.linkChecks {
+		if r.Problem != "" {
+			result = append(result, r.String())
+		}
+	}
+	return result
+}
+
+// redirects describes the links that have a different final URL.
+func (pending *pendingPost) redirects() []string {
+	var result []string
+	for _, r := range pending.linkChecks {
+		if r.Redirected() {
+			result = append(result, r.String())
+		}
+	}
+	return result
+}
+
+// useFinalURLs substitutes the final URLs for the redirected links in the
+// message. The source (e.g. the Pinboard bookmark) stays as is, so the
+// post is still recorded under its original URL.
+func (pending *pendingPost) useFinalURLs() {
+	for _, r := range pending.linkChecks {
+		if r.Redirected() {
+			pending.post.replaceURL(r.URL, r.FinalURL)
+			r.URL = r.FinalURL
+		}
+	}
+}
+
+func (post *Post) replaceURL(old, new string) {
+	if post.URL == old {
+		post.URL = new
+	}
+	for key, u := range post.Links {
+		if u == old {
+			post.Links[key] = new
+		}
+	}
+	for _, links := range [][]Link{post.StickyLinks, post.LinkButtons} {
+		for i := range links {
+			if links[i].URL == old {
+				links[i].URL = new
+			}
+		}
+	}
+	for _, r := range post.Description {
+		if r.LinkValue == old {
+			r.LinkValue = new
+		}
+	}
+	if post.Preview != nil && post.Preview.URL == old {
+		post.Preview.URL = new
+	}
+}
@@ -2,136 +2,258 @@ package main
 
 import (
 	"flag"
-	"io/ioutil"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/curlstr"
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/httpfixture"
 	"github.com/andreyvit/yesterdaytechnewsbot/internal/pinboard"
 	"github.com/andreyvit/yesterdaytechnewsbot/internal/telegram"
 )
 
+// userAgent is sent when fetching the linked pages, as some sites turn away
+// clients that don't look like browsers.
+const userAgent = "Mozilla/5.0 (compatible; yesterdaytechnewsbot)"
+
 func main() {
 	log.SetOutput(os.Stderr)
 	log.SetFlags(0)
 
 	conf := Configuration{
 		Pinboard: pinboard.Options{
-			Credentials: pinboard.Credentials{
-				Username: needEnvString("PINBOARD_USER"),
-				Password: needEnvString("PINBOARD_PASSWORD"),
-			},
+			Credentials: needPinboardCredentials(),
 		},
 		Telegram: telegram.Options{
 			Credentials: telegram.Credentials{
-				BotToken:    needEnvString("TELEGRAM_BOT_TOKEN"),
-				ChannelName: needEnvString("TELEGRAM_CHANNEL_NAME"),
+				BotToken: needEnvString("TELEGRAM_BOT_TOKEN"),
 			},
 			DryMode: needEnvBool("TELEGRAM_DRY_RUN"),
 		},
-		Content: ContentOptions{
-			MarkerTag:       "ytn",
-			SkipTags:        []string{},
-			TrimTagPrefixes: []string{"ytn-"},
-			StickyLinks:     []string{"HN"},
-			TagRenames: map[string]string{
-				"penetration-testing": "pentesting",
-			},
-			Categories: []*Category{
-				{
-					Tags:  []string{"ytn-must"},
-					Title: "MUST READ",
-				},
-				{
-					Tags:  []string{"nifty"},
-					Title: "Nifty-Grifty",
-				},
-				{
-					Tags:  []string{"languages"},
-					Title: "Platforms and Languages",
-				},
-				{
-					Tags:  []string{"library"},
-					Title: "Libraries",
-				},
-				{
-					Tags:  []string{"business"},
-					Title: "Entrepreneurship and Business",
-				},
-				{
-					Tags:  []string{"ux"},
-					Title: "UX",
-				},
-				{
-					Tags:  []string{"databases"},
-					Title: "Databases",
-				},
-				{
-					Tags:  []string{"tech"},
-					Title: "Technologies",
-				},
-				{
-					Tags:  []string{"ai"},
-					Title: "Machine Learning / AI",
-				},
-				{
-					Tags:  []string{"diy"},
-					Title: "DIY",
-				},
-				{
-					Tags:  []string{"tools"},
-					Title: "Tools",
-				},
-				{
-					Tags:  []string{"math"},
-					Title: "Math",
-				},
-				{
-					Tags:  []string{"tutorial"},
-					Title: "Tutorials",
-				},
-				{
-					Tags:  []string{"security"},
-					Title: "Security",
-				},
-				{
-					Tags:  []string{"bignames"},
-					Title: "Big Names",
-				},
-				{
-					Tags:  []string{"nontech"},
-					Title: "Non-Tech",
-				},
-				{
-					Tags:  []string{"kids"},
-					Title: "Kids",
-				},
-				{
-					Tags:  []string{"fun"},
-					Title: "Fun",
-				},
-			},
-		},
+		Content:   defaultContentOptions(),
 		StateFile: needEnvString("BOT_STATE_PATH"),
 	}
 
+	parseMode := needParseMode("TELEGRAM_PARSE_MODE")
+	conf.Destinations = []*Destination{
+		{
+			Key:       ChannelTelegram,
+			Chat:      needChat("TELEGRAM_CHANNEL_NAME"),
+			ParseMode: parseMode,
+		},
+	}
+	if s := os.Getenv("TELEGRAM_EXTRA_DESTINATIONS"); s != "" {
+		dests, err := parseDestinations(s, parseMode)
+		if err != nil {
+			log.Fatalf("** Invalid value of environment variable TELEGRAM_EXTRA_DESTINATIONS: %v", err)
+		}
+		for _, dest := range dests {
+			if dest.Key == ChannelTelegram {
+				log.Fatalf("** Invalid value of environment variable TELEGRAM_EXTRA_DESTINATIONS: key %q is reserved for TELEGRAM_CHANNEL_NAME", dest.Key)
+			}
+		}
+		conf.Destinations = append(conf.Destinations, dests...)
+	}
+
+	if s := os.Getenv("IMAGE_DIR"); s != "" {
+		dir, err := filepath.Abs(s)
+		if err != nil {
+			log.Fatalf("** Invalid value of environment variable IMAGE_DIR: %v", err)
+		}
+		conf.Content.ImageDir = dir
+	}
+
+	conf.Sources.InboxDir = os.Getenv("INBOX_DIR")
+	for _, u := range strings.Fields(os.Getenv("FEED_URLS")) {
+		conf.Sources.Feeds = append(conf.Sources.Feeds, FeedOptions{
+			URL:       u,
+			MarkerTag: os.Getenv("FEED_MARKER_TAG"),
+		})
+	}
+
+	conf.Sources.ImportFiles = strings.Fields(os.Getenv("IMPORT_FILES"))
+
+	conf.StatusTags = StatusTagOptions{
+		Published: os.Getenv("PINBOARD_PUBLISHED_TAG"),
+		Skipped:   os.Getenv("PINBOARD_SKIPPED_TAG"),
+	}
+	conf.Content.SkipTags = append(conf.Content.SkipTags, conf.StatusTags.Tags()...)
+
+	conf.HN.Lookup = envBool("HN_LOOKUP")
+	conf.HN.CommentCounts = envBool("HN_COMMENT_COUNTS")
+	conf.HN.Discover = envBool("HN_DISCOVER")
+
+	conf.Enrich.Enabled = envBool("ENRICH")
+	conf.Enrich.UserAgent = userAgent
+	conf.Enrich.GitHubToken = os.Getenv("GITHUB_TOKEN")
+	conf.Enrich.CacheDir = os.Getenv("ENRICH_CACHE_DIR")
+	conf.Enrich.CacheTTL = envDuration("ENRICH_CACHE_TTL", 24*time.Hour)
+
+	conf.LinkCheck.Enabled = envBool("LINK_CHECK")
+	conf.LinkCheck.UserAgent = userAgent
+	if s := os.Getenv("LINK_CHECK_PER_HOST"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			log.Fatalf("** Invalid value of environment variable LINK_CHECK_PER_HOST, expected a positive integer: %q", s)
+		}
+		conf.LinkCheck.PerHost = n
+	}
+
+	conf.PublishPrivate = envBool("PUBLISH_PRIVATE_BOOKMARKS")
+	conf.PublishUnread = envBool("PUBLISH_UNREAD_BOOKMARKS")
+
 	flag.BoolVar(&conf.RepublishAll, "repub", false, "republish all articles")
+	addr := flag.String("addr", "localhost:8080", "address to listen on for the serve command")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] [command]\n\nCommands:\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "  (none)  review pending posts in the terminal\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  bot     review pending posts and accept submitted links via Telegram\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  serve   review pending posts in a local web UI\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  rebuild-state  record the bookmarks with status tags in the state file\n\nOptions:\n")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	if s := needEnvString("PINBOARD_MOCK_DATA"); s != "0" {
-		data, err := ioutil.ReadFile(s)
-		if err != nil {
-			log.Fatalf("** Cannot read file specified by PINBOARD_MOCK_DATA: %v", err)
-		}
-		conf.Pinboard.MockData = data
+		conf.Sources.PinboardFile = s
 	}
 
-	err := Run(conf)
+	// logged curl commands hide credentials unless asked otherwise
+	curlstr.Redact = !envBool("CURL_LOG_SECRETS")
+
+	fixtures, err := httpfixture.Parse(os.Getenv("HTTP_FIXTURES"), conf.Pinboard.Password, conf.Pinboard.APIToken, conf.Telegram.BotToken)
+	if err != nil {
+		log.Fatalf("** Invalid value of environment variable HTTP_FIXTURES: %v", err)
+	}
+	if fixtures != nil {
+		conf.Pinboard.Transport = fixtures
+		conf.Telegram.Transport = fixtures
+		conf.HN.Transport = fixtures
+		conf.Enrich.Transport = fixtures
+		conf.LinkCheck.Transport = fixtures
+		conf.Sources.Transport = fixtures
+	}
+
+	switch cmd := flag.Arg(0); cmd {
+	case "":
+		err = Run(conf)
+	case "bot":
+		conf.Bot = BotOptions{
+			AdminChat:      needChat("TELEGRAM_ADMIN_CHAT"),
+			AdminUserIDs:   needEnvInt64s("TELEGRAM_ADMIN_USER_IDS"),
+			SaveToPinboard: needEnvBool("TELEGRAM_SUBMISSIONS_TO_PINBOARD"),
+		}
+		err = RunBot(conf)
+	case "serve":
+		err = RunServer(conf, *addr)
+	case "rebuild-state":
+		err = RebuildState(conf)
+	default:
+		log.Fatalf("** Unknown command %q", cmd)
+	}
 	if err != nil {
 		log.Fatalf("** %v", err)
 	}
 }
 
+// defaultContentOptions is the channel's content configuration.
+func defaultContentOptions() ContentOptions {
+	return ContentOptions{
+		MarkerTag:       "ytn",
+		SkipTags:        []string{},
+		TrimTagPrefixes: []string{"ytn-"},
+		StickyLinks:     []string{"HN", "Lobsters", "Reddit", "Tildes", "Slashdot", "GitHub_issue", "GitHub_discussion", "YouTube", "PDF"},
+		LongMessages:    LongMessageTruncate,
+		PreviewTag:      "preview",
+
+		StickyLinkButtons: false,
+		LinkLabels: map[string]LinkLabel{
+			"HN": {Label: "HN discussion", Emoji: "💬"},
+		},
+		TagRenames: map[string]string{
+			"penetration-testing": "pentesting",
+		},
+		Categories: []*Category{
+			{
+				Tags:  []string{"ytn-must"},
+				Title: "MUST READ",
+			},
+			{
+				Tags:  []string{"nifty"},
+				Title: "Nifty-Grifty",
+			},
+			{
+				Tags:  []string{"languages"},
+				Title: "Platforms and Languages",
+			},
+			{
+				Tags:  []string{"library"},
+				Title: "Libraries",
+			},
+			{
+				Tags:  []string{"business"},
+				Title: "Entrepreneurship and Business",
+			},
+			{
+				Tags:  []string{"ux"},
+				Title: "UX",
+			},
+			{
+				Tags:  []string{"databases"},
+				Title: "Databases",
+			},
+			{
+				Tags:  []string{"tech"},
+				Title: "Technologies",
+			},
+			{
+				Tags:  []string{"ai"},
+				Title: "Machine Learning / AI",
+			},
+			{
+				Tags:  []string{"diy"},
+				Title: "DIY",
+			},
+			{
+				Tags:  []string{"tools"},
+				Title: "Tools",
+			},
+			{
+				Tags:  []string{"math"},
+				Title: "Math",
+			},
+			{
+				Tags:  []string{"tutorial"},
+				Title: "Tutorials",
+			},
+			{
+				Tags:  []string{"security"},
+				Title: "Security",
+			},
+			{
+				Tags:  []string{"bignames"},
+				Title: "Big Names",
+			},
+			{
+				Tags:  []string{"nontech"},
+				Title: "Non-Tech",
+			},
+			{
+				Tags:  []string{"kids"},
+				Title: "Kids",
+			},
+			{
+				Tags:  []string{"fun"},
+				Title: "Fun",
+			},
+		},
+	}
+}
+
 func needEnvString(key string) string {
 	s := os.Getenv(key)
 	if s == "" {
@@ -140,6 +262,57 @@ func needEnvString(key string) string {
 	return s
 }
 
+func needEnvInt64s(key string) []int64 {
+	var result []int64
+	for _, s := range strings.FieldsFunc(needEnvString(key), isListSeparator) {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			log.Fatalf("** Invalid value of environment variable %s, expected a list of integers: %q", key, s)
+		}
+		result = append(result, v)
+	}
+	return result
+}
+
+func isListSeparator(r rune) bool {
+	return r == ',' || r == ' '
+}
+
+// needPinboardCredentials prefers PINBOARD_API_TOKEN over the password.
+func needPinboardCredentials() pinboard.Credentials {
+	if token := os.Getenv("PINBOARD_API_TOKEN"); token != "" {
+		return pinboard.Credentials{APIToken: token}
+	}
+	return pinboard.Credentials{
+		Username: needEnvString("PINBOARD_USER"),
+		Password: needEnvString("PINBOARD_PASSWORD"),
+	}
+}
+
+func needChat(key string) telegram.Chat {
+	chat, err := telegram.ParseChat(needEnvString(key))
+	if err != nil {
+		log.Fatalf("** Invalid value of environment variable %s: %v", key, err)
+	}
+	return chat
+}
+
+func needParseMode(key string) telegram.ParseMode {
+	mode, err := telegram.ParseParseMode(os.Getenv(key))
+	if err != nil {
+		log.Fatalf("** Invalid value of environment variable %s: %v", key, err)
+	}
+	return mode
+}
+
+// envBool is like needEnvBool, but defaults to false.
+func envBool(key string) bool {
+	if os.Getenv(key) == "" {
+		return false
+	}
+	return needEnvBool(key)
+}
+
 func needEnvBool(key string) bool {
 	s := os.Getenv(key)
 	if s == "" {
@@ -156,3 +329,16 @@ func needEnvBool(key string) bool {
 		panic("unreachable")
 	}
 }
+
+// envDuration parses a duration like 24h, returning def if the variable is unset.
+func envDuration(key string, def time.Duration) time.Duration {
+	s := os.Getenv(key)
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		log.Fatalf("** Invalid value of environment variable %s, expected a duration like 24h: %q", key, s)
+	}
+	return d
+}
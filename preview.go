@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/telegram"
+)
+
+type PreviewSize string
+
+const (
+	PreviewSizeDefault PreviewSize = ""
+	PreviewSizeSmall   PreviewSize = "small"
+	PreviewSizeLarge   PreviewSize = "large"
+)
+
+// PreviewOptions control the link preview card shown under (or above)
+// a post. A nil *PreviewOptions means no preview.
+type PreviewOptions struct {
+	Size      PreviewSize
+	AboveText bool
+	// URL overrides the previewed link, defaults to the post URL
+	URL string
+}
+
+const (
+	// LinkNamePreview is the trailing link key that picks the previewed URL.
+	LinkNamePreview = "preview"
+)
+
+func (po *PreviewOptions) String() string {
+	if po == nil {
+		return "disabled"
+	}
+	var buf strings.Builder
+	switch po.Size {
+	case PreviewSizeSmall:
+		buf.WriteString("small media")
+	case PreviewSizeLarge:
+		buf.WriteString("large media")
+	default:
+		buf.WriteString("default media")
+	}
+	if po.AboveText {
+		buf.WriteString(", above text")
+	} else {
+		buf.WriteString(", below text")
+	}
+	if po.URL != "" {
+		buf.WriteString(", ")
+		buf.WriteString(po.URL)
+	}
+	return buf.String()
+}
+
+func (po *PreviewOptions) telegramOptions() *telegram.LinkPreviewOptions {
+	if po == nil {
+		return nil
+	}
+	return &telegram.LinkPreviewOptions{
+		URL:              po.URL,
+		PreferSmallMedia: po.Size == PreviewSizeSmall,
+		PreferLargeMedia: po.Size == PreviewSizeLarge,
+		ShowAboveText:    po.AboveText,
+	}
+}
+
+// applyPreviewTags adjusts preview options according to preview control tags
+// (like preview, preview-large, preview-above or nopreview) and returns
+// the remaining tags. Other tags with the prefix, like preview-release, are
+// kept as regular tags.
+func applyPreviewTags(po *PreviewOptions, tags []string, previewTag string) (*PreviewOptions, []string) {
+	if previewTag == "" {
+		return po, tags
+	}
+
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag == "no"+previewTag {
+			po = nil
+			continue
+		}
+		var option string
+		if tag != previewTag {
+			option = strings.TrimPrefix(tag, previewTag+"-")
+			if option == tag || !previewOptions[option] {
+				result = append(result, tag)
+				continue
+			}
+		}
+
+		if po == nil {
+			po = new(PreviewOptions)
+		} else {
+			cp := *po
+			po = &cp
+		}
+		switch option {
+		case "small":
+			po.Size = PreviewSizeSmall
+		case "large":
+			po.Size = PreviewSizeLarge
+		case "above":
+			po.AboveText = true
+		case "below":
+			po.AboveText = false
+		}
+	}
+	return po, result
+}
+
+var previewOptions = map[string]bool{"small": true, "large": true, "above": true, "below": true}
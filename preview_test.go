@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyPreviewTags(t *testing.T) {
+	tests := []struct {
+		Tags         []string
+		Expected     *PreviewOptions
+		ExpectedTags []string
+	}{
+		{[]string{"go"}, nil, []string{"go"}},
+		{[]string{"preview", "go"}, &PreviewOptions{}, []string{"go"}},
+		{[]string{"preview-large", "preview-above"}, &PreviewOptions{Size: PreviewSizeLarge, AboveText: true}, []string{}},
+		{[]string{"preview-release", "go"}, nil, []string{"preview-release", "go"}},
+		{[]string{"preview", "nopreview"}, nil, []string{}},
+	}
+	for _, test := range tests {
+		po, tags := applyPreviewTags(nil, test.Tags, "preview")
+		if !reflect.DeepEqual(po, test.Expected) || !reflect.DeepEqual(tags, test.ExpectedTags) {
+			t.Errorf("applyPreviewTags(%q) = %+v, %q, wanted %+v, %q", test.Tags, po, tags, test.Expected, test.ExpectedTags)
+		}
+	}
+}
+
+func TestParsePostPreviewURL(t *testing.T) {
+	opt := ContentOptions{
+		MarkerTag:  "ytn",
+		PreviewTag: "preview",
+		Categories: []*Category{{Tags: []string{"security"}, Title: "Security"}},
+	}
+	tests := []struct {
+		URL         string
+		Description string
+		Expected    string
+	}{
+		{"https://example.com/a", "", "https://example.com/a"},
+		{"https://example.com/a", "Text.\n\npreview: https://example.com/b", "https://example.com/b"},
+		// filled in by the HN lookup
+		{"https://news.ycombinator.com/item?id=1", "", ""},
+	}
+	for _, test := range tests {
+		post, err := parsePost(&Candidate{URL: test.URL, Title: "T", Tags: []string{"ytn", "security", "preview"}, Description: test.Description}, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if post.Preview == nil || post.Preview.URL != test.Expected {
+			t.Errorf("parsePost(%q, %q).Preview = %+v, wanted URL %q", test.URL, test.Description, post.Preview, test.Expected)
+		}
+	}
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/telegram"
+)
+
+// previewServer is a local web UI for reviewing pending posts, rendered
+// roughly the way Telegram shows them.
+type previewServer struct {
+	env *Env
+
+	mut     sync.Mutex
+	pending []*pendingPost
+	flash   string
+}
+
+// RunServer loads the pending posts and serves the review UI on addr until
+// interrupted. Decisions go through the same code as the terminal prompt.
+func RunServer(conf Configuration, addr string) error {
+	env, err := newEnv(conf)
+	if err != nil {
+		return err
+	}
+
+	srv := &previewServer{env: env}
+	cands, err := loadCandidates(env.Sources)
+	if err != nil {
+		return err
+	}
+	for _, c := range cands {
+		pending, err := env.prepare(c)
+		if err != nil {
+			return fmt.Errorf("%v [while handling: %s]", err, c.TitleOrURL())
+		}
+		if pending != nil {
+			srv.pending = append(srv.pending, pending)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", srv.handleIndex)
+	mux.HandleFunc("/decide", srv.handleDecide)
+	mux.HandleFunc("/edit", srv.handleEdit)
+	mux.HandleFunc("/hn", srv.handleHN)
+	mux.HandleFunc("/final-urls", srv.handleFinalURLs)
+
+	log.Printf("Reviewing %d pending posts at http://%s/", len(srv.pending), addr)
+	return http.ListenAndServe(addr, boundHost(addr, sameOrigin(mux)))
+}
+
+// boundHost rejects the requests addressed to another host name, so that
+// a site whose domain is rebound to this machine cannot reach the server.
+func boundHost(addr string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isBoundHost(r.Host, addr) {
+			log.Printf("[serve] WARNING: rejected %s %s for host %q", r.Method, r.URL.Path, r.Host)
+			http.Error(w, "Unknown host", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// isBoundHost tells if host (a Host header) names the listening address.
+// When listening on all interfaces, any IP address will do, but no domain
+// other than localhost.
+func isBoundHost(host, addr string) bool {
+	bindHost, bindPort, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	reqHost, reqPort, err := net.SplitHostPort(host)
+	if err != nil {
+		reqHost, reqPort = host, "80"
+	}
+	if reqPort != bindPort {
+		return false
+	}
+	ip := net.ParseIP(reqHost)
+	if bindIP := net.ParseIP(bindHost); bindHost == "" || bindIP != nil && bindIP.IsUnspecified() {
+		return ip != nil || strings.EqualFold(reqHost, "localhost")
+	}
+	if strings.EqualFold(bindHost, "localhost") && ip != nil && ip.IsLoopback() {
+		return true
+	}
+	return strings.EqualFold(reqHost, bindHost)
+}
+
+// sameOrigin rejects the POST requests coming from other sites, so that
+// a page open in the same browser cannot publish or edit posts.
+func sameOrigin(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !isSameOrigin(r) {
+			log.Printf("[serve] WARNING: rejected cross-origin %s %s from %q", r.Method, r.URL.Path, r.Header.Get("Origin"))
+			http.Error(w, "Cross-origin request rejected", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func isSameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin"
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	if origin == "" {
+		// not a browser
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+func pendingID(pending *pendingPost) string {
+	return HashOfURL(pending.cand.URL)[:12]
+}
+
+func (srv *previewServer) lookup(id string) (int, *pendingPost) {
+	for i, pending := range srv.pending {
+		if pendingID(pending) == id {
+			return i, pending
+		}
+	}
+	return -1, nil
+}
+
+func (srv *previewServer) remove(i int) {
+	srv.pending = append(srv.pending[:i], srv.pending[i+1:]...)
+}
+
+func (srv *previewServer) redirect(w http.ResponseWriter, r *http.Request, flash string) {
+	srv.flash = flash
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (srv *previewServer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	srv.mut.Lock()
+	defer srv.mut.Unlock()
+
+	data := indexData{Flash: srv.flash}
+	srv.flash = ""
+	for _, pending := range srv.pending {
+		data.Pending = append(data.Pending, srv.render(pending))
+	}
+	data.History = buildHistory(srv.env.State)
+	srv.execute(w, "index", data)
+}
+
+func (srv *previewServer) handleDecide(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	srv.mut.Lock()
+	defer srv.mut.Unlock()
+
+	i, pending := srv.lookup(r.FormValue("id"))
+	if pending == nil {
+		srv.redirect(w, r, "This post is no longer pending.")
+		return
+	}
+
+	decision := Decision(0)
+	if s := r.FormValue("decision"); len(s) == 1 {
+		decision = Decision(s[0])
+	}
+	var status string
+	switch decision {
+	case DecisionPublish:
+		if len(pending.warnings) > 0 {
+			if r.FormValue("confirm") == "" {
+				srv.redirect(w, r, fmt.Sprintf("Not published: %s is a %s bookmark, tick “publish anyway” to confirm.", pending.cand.TitleOrURL(), pending.warning()))
+				return
+			}
+			pending.confirmed = true
+		}
+		status = "Published to " + describeDestinations(pending.dests)
+	case DecisionLater:
+		status = "Left for later"
+	case DecisionSkip:
+		status = "Skipped permanently"
+	default:
+		http.Error(w, "invalid decision", http.StatusBadRequest)
+		return
+	}
+
+	if err := srv.env.decide(pending, decision); err != nil {
+		log.Printf("[serve] WARNING: %v", err)
+		srv.redirect(w, r, fmt.Sprintf("Failed: %s: %v", pending.cand.TitleOrURL(), err))
+		return
+	}
+	srv.remove(i)
+	srv.redirect(w, r, status+": "+pending.cand.TitleOrURL())
+}
+
+// handleHN adds the suggested HN link to the post and its bookmark.
+func (srv *previewServer) handleHN(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	srv.mut.Lock()
+	defer srv.mut.Unlock()
+
+	_, pending := srv.lookup(r.FormValue("id"))
+	if pending == nil || pending.hnSuggestion == nil {
+		srv.redirect(w, r, "This post is no longer pending.")
+		return
+	}
+	srv.env.acceptHNSuggestion(pending)
+	srv.redirect(w, r, "Added the HN link: "+pending.cand.TitleOrURL())
+}
+
+// handleFinalURLs substitutes the final URLs for the redirected links.
+func (srv *previewServer) handleFinalURLs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	srv.mut.Lock()
+	defer srv.mut.Unlock()
+
+	_, pending := srv.lookup(r.FormValue("id"))
+	if pending == nil {
+		srv.redirect(w, r, "This post is no longer pending.")
+		return
+	}
+	pending.useFinalURLs()
+	srv.redirect(w, r, "Using the final URLs: "+pending.cand.TitleOrURL())
+}
+
+// handleEdit changes the candidate locally before publishing; the source
+// (e.g. the Pinboard bookmark) stays as is.
+func (srv *previewServer) handleEdit(w http.ResponseWriter, r *http.Request) {
+	srv.mut.Lock()
+	defer srv.mut.Unlock()
+
+	i, pending := srv.lookup(r.FormValue("id"))
+	if pending == nil {
+		srv.redirect(w, r, "This post is no longer pending.")
+		return
+	}
+	c := pending.cand
+
+	if r.Method != http.MethodPost {
+		srv.execute(w, "edit", editData{
+			ID:          pendingID(pending),
+			Title:       c.Title,
+			Tags:        strings.Join(c.Tags, " "),
+			Description: c.Description,
+		})
+		return
+	}
+
+	edited := *c
+	edited.Title = strings.TrimSpace(r.FormValue("title"))
+	edited.Tags = strings.Fields(r.FormValue("tags"))
+	edited.Description = strings.ReplaceAll(r.FormValue("description"), "\r\n", "\n")
+
+	// prepare skips a post it cannot parse, but a typo in the edit must not
+	// drop the post
+	post, err := parsePost(&edited, srv.env.Conf.Content)
+	if err == nil {
+		err = checkTopics(post.Options, srv.env.Conf.Destinations)
+	}
+	if err == nil {
+		err = checkImage(post.Image, srv.env.Conf.Content.ImageDir)
+	}
+	if err != nil {
+		srv.redirect(w, r, fmt.Sprintf("Cannot apply the edit: %v", err))
+		return
+	}
+
+	updated, err := srv.env.prepare(&edited)
+	if err != nil {
+		srv.redirect(w, r, fmt.Sprintf("Cannot apply the edit: %v", err))
+		return
+	}
+	if updated == nil {
+		srv.remove(i)
+		srv.redirect(w, r, "After the edit, there is nothing to publish (no category or destinations): "+edited.TitleOrURL())
+		return
+	}
+	srv.pending[i] = updated
+	srv.redirect(w, r, "Updated: "+edited.TitleOrURL())
+}
+
+type indexData struct {
+	Flash   string
+	Pending []*renderedPost
+	History []*historyItem
+}
+
+type renderedPost struct {
+	ID           string
+	Source       string
+	URL          string
+	Category     string
+	Destinations string
+	Republishing bool
+	Options      string
+	HN           string
+	HNSuggestion string
+	Meta         string
+	BrokenLinks  []string
+	Redirects    []string
+	// Warning is set for a bookmark that needs confirmation, like "private"
+	Warning   string
+	PhotoURL  string
+	PhotoPath string
+	// PreviewCard describes the link preview, if any
+	PreviewCard  string
+	PreviewAbove bool
+	Messages     []template.HTML
+	Buttons      [][]telegram.InlineButton
+}
+
+// render formats the post with the HTML parse mode, whose markup is
+// a subset of HTML that browsers display much like Telegram does.
+func (srv *previewServer) render(pending *pendingPost) *renderedPost {
+	post := pending.post
+	rp := &renderedPost{
+		ID:           pendingID(pending),
+		Source:       pending.cand.Source,
+		URL:          post.URL,
+		Category:     post.Category.Title,
+		Destinations: describeDestinations(pending.dests),
+		Republishing: pending.republishing,
+		Options:      post.Options.String(),
+		HN:           pending.hnSummary(),
+		HNSuggestion: pending.hnSuggestionSummary(),
+		Meta:         post.Meta.String(),
+		BrokenLinks:  pending.brokenLinks(),
+		Redirects:    pending.redirects(),
+		Warning:      pending.warning(),
+	}
+	if post.Image != nil {
+		rp.PhotoURL, rp.PhotoPath = post.Image.URL, post.Image.Path
+	}
+	if post.Preview != nil {
+		previewURL := post.Preview.URL
+		if previewURL == "" {
+			previewURL = post.URL
+		}
+		if u, err := url.Parse(previewURL); err == nil {
+			rp.PreviewCard = u.Host + " · "
+		}
+		rp.PreviewCard += post.Preview.String()
+		rp.PreviewAbove = post.Preview.AboveText
+	}
+	for _, msg := range buildTelegramMessages(post, telegram.ParseModeHTML, srv.env.Conf.Content) {
+		if msg.HTMLText != "" {
+			rp.Messages = append(rp.Messages, webLinksOnly(msg.HTMLText))
+		}
+		rp.Buttons = append(rp.Buttons, msg.Buttons...)
+	}
+	return rp
+}
+
+// hrefRe matches the link targets in the HTML of a message; quotes are
+// escaped everywhere else.
+var hrefRe = regexp.MustCompile(`href="([^"]*)"`)
+
+// webLinksOnly disarms the links of a rendered message that don't lead to
+// a web page, like javascript: ones, since the message is shown as is.
+func webLinksOnly(htmlText string) template.HTML {
+	return template.HTML(hrefRe.ReplaceAllStringFunc(htmlText, func(attr string) string {
+		if isWebURL(html.UnescapeString(hrefRe.FindStringSubmatch(attr)[1])) {
+			return attr
+		}
+		return `href="#"`
+	}))
+}
+
+type historyItem struct {
+	URL          string
+	Time         time.Time
+	Destinations string
+}
+
+const maxHistoryItems = 100
+
+// buildHistory lists the published articles, most recent first.
+func buildHistory(state *State) []*historyItem {
+	var items []*historyItem
+	for _, as := range state.PublishedArticles {
+		if len(as.Channels) == 0 {
+			continue
+		}
+		item := &historyItem{URL: as.URL}
+		var keys []string
+		for key, cs := range as.Channels {
+			keys = append(keys, key)
+			if cs.PublishTime.After(item.Time) {
+				item.Time = cs.PublishTime
+			}
+		}
+		sort.Strings(keys)
+		item.Destinations = strings.Join(keys, ", ")
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Time.After(items[j].Time)
+	})
+	if len(items) > maxHistoryItems {
+		items = items[:maxHistoryItems]
+	}
+	return items
+}
+
+type editData struct {
+	ID          string
+	Title       string
+	Tags        string
+	Description string
+}
+
+func (srv *previewServer) execute(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := serverTemplates.ExecuteTemplate(w, name, data); err != nil {
+		log.Printf("[serve] WARNING: rendering %s: %v", name, err)
+	}
+}
+
+var serverTemplates = template.Must(template.New("").Funcs(template.FuncMap{
+	"formatTime": func(t time.Time) string {
+		return t.Local().Format("2006-01-02 15:04")
+	},
+}).Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.}}</title>
+<style>
+body { font: 15px/1.4 -apple-system, "Segoe UI", Roboto, sans-serif; background: #99ba92; margin: 0; padding: 1em; }
+main { max-width: 560px; margin: 0 auto; }
+h1 { font-size: 18px; color: #fff; }
+.flash { background: #fffbe6; padding: .5em 1em; border-radius: 8px; }
+.post { margin: 1.5em 0; }
+.meta { font-size: 13px; color: #fff; margin-bottom: .3em; }
+.bubble { background: #fff; border-radius: 12px; padding: .5em .8em; margin: .3em 0; white-space: pre-wrap; word-wrap: break-word; }
+.bubble a { color: #168acd; text-decoration: none; }
+.bubble blockquote { border-left: 3px solid #168acd; margin: .2em 0; padding-left: .6em; }
+.bubble img { max-width: 100%; border-radius: 8px; }
+.card { border-left: 3px solid #168acd; padding: .2em .6em; margin: .3em 0; font-size: 13px; color: #555; }
+.keyboard { display: flex; flex-wrap: wrap; gap: 4px; }
+.keyboard a { flex: 1; text-align: center; background: rgba(0,0,0,.25); color: #fff; border-radius: 8px; padding: .3em; text-decoration: none; font-size: 13px; }
+.actions { margin-top: .4em; }
+.actions button, .actions a { font-size: 13px; margin-right: .3em; }
+.actions .warning { font-size: 13px; color: #fff; }
+table { background: #fff; border-radius: 8px; width: 100%; font-size: 13px; }
+td { padding: .2em .5em; }
+form.edit input, form.edit textarea { width: 100%; box-sizing: border-box; font: inherit; }
+</style></head><body><main>{{end}}
+
+{{define "index"}}{{template "head" "Pending posts"}}
+{{if .Flash}}<p class="flash">{{.Flash}}</p>{{end}}
+<h1>Pending ({{len .Pending}})</h1>
+{{range .Pending}}
+<div class="post">
+  <div class="meta">{{.Category}} → {{.Destinations}}{{if .Republishing}} (republishing){{end}} · via {{.Source}}{{if .Options}} · {{.Options}}{{end}}</div>
+  {{if .HN}}<div class="meta">HN: {{.HN}}</div>{{end}}
+  {{if .Meta}}<div class="meta">{{.Meta}}</div>{{end}}
+  {{range .BrokenLinks}}<div class="meta">⚠️ broken link: {{.}}</div>{{end}}
+  {{if .Redirects}}<form class="actions" method="post" action="/final-urls"><input type="hidden" name="id" value="{{.ID}}">{{range .Redirects}}<div class="meta">↪ {{.}}</div>{{end}}<button>Use final URLs</button></form>{{end}}
+  {{if .HNSuggestion}}<form class="actions" method="post" action="/hn"><input type="hidden" name="id" value="{{.ID}}"><span class="meta">HN discussion found: {{.HNSuggestion}}</span> <button>Add HN link</button></form>{{end}}
+  {{if .PhotoURL}}<div class="bubble"><img src="{{.PhotoURL}}" alt=""></div>{{else if .PhotoPath}}<div class="bubble">🖼 {{.PhotoPath}}</div>{{end}}
+  {{$post := .}}
+  {{range $i, $msg := .Messages}}<div class="bubble">{{if eq $i 0}}{{if $post.PreviewAbove}}<div class="card">🔗 {{$post.PreviewCard}}</div>{{end}}{{end}}{{$msg}}{{if eq $i 0}}{{if and $post.PreviewCard (not $post.PreviewAbove)}}<div class="card">🔗 {{$post.PreviewCard}}</div>{{end}}{{end}}</div>{{end}}
+  {{range .Buttons}}<div class="keyboard">{{range .}}<a href="{{.URL}}">{{.Text}}</a>{{end}}</div>{{end}}
+  <form class="actions" method="post" action="/decide">
+    <input type="hidden" name="id" value="{{.ID}}">
+    {{if .Warning}}<label class="warning">⚠️ {{.Warning}} bookmark: <input type="checkbox" name="confirm" value="1"> publish anyway</label><br>{{end}}
+    <button name="decision" value="P">Publish</button>
+    <button name="decision" value="L">Later</button>
+    <button name="decision" value="S">Skip</button>
+    <a href="/edit?id={{.ID}}">Edit</a>
+  </form>
+</div>
+{{else}}
+<p class="flash">Nothing to publish.</p>
+{{end}}
+<h1>History</h1>
+<table>
+{{range .History}}<tr><td>{{formatTime .Time}}</td><td><a href="{{.URL}}">{{.URL}}</a></td><td>{{.Destinations}}</td></tr>
+{{end}}
+</table>
+</main></body></html>{{end}}
+
+{{define "edit"}}{{template "head" "Edit post"}}
+<h1>Edit</h1>
+<form class="edit bubble" method="post" action="/edit">
+  <input type="hidden" name="id" value="{{.ID}}">
+  <p>Title<br><input name="title" value="{{.Title}}"></p>
+  <p>Tags<br><input name="tags" value="{{.Tags}}"></p>
+  <p>Description<br><textarea name="description" rows="12">{{.Description}}</textarea></p>
+  <p><button>Save</button> <a href="/">Cancel</a></p>
+</form>
+</main></body></html>{{end}}
+`))
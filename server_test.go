@@ -0,0 +1,194 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/telegram"
+)
+
+func newTestPreviewServer(t *testing.T, tg *fakeTelegram) (*previewServer, *pendingPost) {
+	dir, err := ioutil.TempDir("", "ytn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	log.SetOutput(ioutil.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	env := &Env{
+		Conf: Configuration{
+			Destinations: []*Destination{
+				{Key: ChannelTelegram, Chat: telegram.Chat{ID: "@chan"}, ParseMode: telegram.ParseModeMarkdownV2},
+			},
+			Content: ContentOptions{
+				MarkerTag:  "ytn",
+				PreviewTag: "preview",
+				Categories: []*Category{{Tags: []string{"security"}, Title: "Security"}},
+			},
+			StateFile: filepath.Join(dir, "state.json"),
+		},
+		State:    &State{PublishedArticles: make(map[string]*ArticleState)},
+		Telegram: telegram.NewClient(telegram.Options{}),
+	}
+	env.Telegram.BaseURL = tg.URL
+
+	srv := &previewServer{env: env}
+	pending, err := env.prepare(&Candidate{
+		Source:      SourcePinboard,
+		URL:         "https://example.com/article",
+		Title:       "Some <Article>",
+		Time:        time.Now(),
+		Tags:        []string{"ytn", "security", "preview"},
+		Description: "Worth reading.",
+	})
+	if err != nil || pending == nil {
+		t.Fatalf("prepare = %v, %v", pending, err)
+	}
+	srv.pending = append(srv.pending, pending)
+	return srv, pending
+}
+
+func TestPreviewServer(t *testing.T) {
+	tg := newFakeTelegram(t)
+	defer tg.Close()
+	srv, pending := newTestPreviewServer(t, tg)
+
+	w := httptest.NewRecorder()
+	srv.handleIndex(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	body := w.Body.String()
+	for _, s := range []string{"<b>Some &lt;Article&gt;</b>", "Worth reading.", "example.com · default media", `value="` + pendingID(pending) + `"`} {
+		if !strings.Contains(body, s) {
+			t.Errorf("index page does not contain %q:\n%s", s, body)
+		}
+	}
+
+	form := url.Values{"id": {pendingID(pending)}, "decision": {"P"}}
+	r := httptest.NewRequest(http.MethodPost, "/decide", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	srv.handleDecide(w, r)
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("decide status = %d, wanted %d", w.Code, http.StatusSeeOther)
+	}
+	if len(tg.sent) != 1 {
+		t.Errorf("sent %d messages, wanted 1", len(tg.sent))
+	}
+	if len(srv.pending) != 0 {
+		t.Errorf("%d posts still pending, wanted 0", len(srv.pending))
+	}
+
+	w = httptest.NewRecorder()
+	srv.handleIndex(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	body = w.Body.String()
+	for _, s := range []string{"Published to tg (@chan): Some &lt;Article&gt;", `<a href="https://example.com/article">`} {
+		if !strings.Contains(body, s) {
+			t.Errorf("index page after publishing does not contain %q:\n%s", s, body)
+		}
+	}
+}
+
+func TestPreviewServerKeepsPostAfterBadEdit(t *testing.T) {
+	tg := newFakeTelegram(t)
+	defer tg.Close()
+	srv, pending := newTestPreviewServer(t, tg)
+
+	form := url.Values{"id": {pendingID(pending)}, "title": {"Some Article"}, "tags": {"ytn security"}, "description": {"Worth reading.\r\n\r\n!silnet"}}
+	r := httptest.NewRequest(http.MethodPost, "/edit", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	srv.handleEdit(httptest.NewRecorder(), r)
+
+	if len(srv.pending) != 1 || srv.pending[0] != pending {
+		t.Errorf("pending = %v, wanted the post unchanged", srv.pending)
+	}
+	if !strings.Contains(srv.flash, "unknown directive !silnet") {
+		t.Errorf("flash = %q, wanted the directive error", srv.flash)
+	}
+}
+
+func TestWebLinksOnly(t *testing.T) {
+	tests := []struct {
+		Input    string
+		Expected string
+	}{
+		{`<a href="https://example.com/?a=1&amp;b=2">x</a>`, `<a href="https://example.com/?a=1&amp;b=2">x</a>`},
+		{`<a href="javascript:alert(1)">x</a>`, `<a href="#">x</a>`},
+		{`<a href="JavaScript&#58;alert(1)">x</a>`, `<a href="#">x</a>`},
+		{`<a href=" javascript:alert(1)">x</a>`, `<a href="#">x</a>`},
+		{`<a href="data:text/html,hi">x</a> href=&quot;javascript:&quot;`, `<a href="#">x</a> href=&quot;javascript:&quot;`},
+	}
+	for _, test := range tests {
+		if actual := string(webLinksOnly(test.Input)); actual != test.Expected {
+			t.Errorf("webLinksOnly(%q) = %q, wanted %q", test.Input, actual, test.Expected)
+		}
+	}
+}
+
+func TestIsBoundHost(t *testing.T) {
+	tests := []struct {
+		Host     string
+		Addr     string
+		Expected bool
+	}{
+		{"localhost:8080", "localhost:8080", true},
+		{"LOCALHOST:8080", "localhost:8080", true},
+		{"127.0.0.1:8080", "localhost:8080", true},
+		{"[::1]:8080", "localhost:8080", true},
+		{"localhost:8081", "localhost:8080", false},
+		{"evil.example:8080", "localhost:8080", false},
+		{"127.0.0.1:8080", "127.0.0.1:8080", true},
+		{"localhost:8080", "127.0.0.1:8080", false},
+		{"192.168.1.5:8080", ":8080", true},
+		{"localhost:8080", "0.0.0.0:8080", true},
+		{"evil.example:8080", ":8080", false},
+		{"review.lan", "review.lan:80", true},
+	}
+	for _, test := range tests {
+		if actual := isBoundHost(test.Host, test.Addr); actual != test.Expected {
+			t.Errorf("isBoundHost(%q, %q) = %v, wanted %v", test.Host, test.Addr, actual, test.Expected)
+		}
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	h := sameOrigin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		Method   string
+		Header   string
+		Value    string
+		Expected int
+	}{
+		{http.MethodGet, "Sec-Fetch-Site", "cross-site", http.StatusOK},
+		{http.MethodPost, "Sec-Fetch-Site", "same-origin", http.StatusOK},
+		{http.MethodPost, "Sec-Fetch-Site", "cross-site", http.StatusForbidden},
+		{http.MethodPost, "Sec-Fetch-Site", "same-site", http.StatusForbidden},
+		{http.MethodPost, "Origin", "http://localhost:8080", http.StatusOK},
+		{http.MethodPost, "Origin", "https://evil.example", http.StatusForbidden},
+		{http.MethodPost, "Origin", "null", http.StatusForbidden},
+		{http.MethodPost, "Referer", "http://localhost:8080/", http.StatusOK},
+		{http.MethodPost, "Referer", "https://evil.example/page", http.StatusForbidden},
+		{http.MethodPost, "", "", http.StatusOK},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.Method, "http://localhost:8080/decide", nil)
+		if test.Header != "" {
+			r.Header.Set(test.Header, test.Value)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.Expected {
+			t.Errorf("%s with %s: %s = %d, wanted %d", test.Method, test.Header, test.Value, w.Code, test.Expected)
+		}
+	}
+}
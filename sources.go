@@ -0,0 +1,451 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/feed"
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/pinboard"
+)
+
+// Candidate is a link that might get published, whatever source it came from.
+type Candidate struct {
+	Source      string
+	URL         string
+	Title       string
+	Time        time.Time
+	Tags        []string
+	Description string
+	Private     bool
+	ToRead      bool
+}
+
+func (c *Candidate) TitleOrURL() string {
+	if c.Title != "" {
+		return c.Title
+	}
+	return c.URL
+}
+
+func (c *Candidate) String() string {
+	var buf strings.Builder
+	if c.Title != "" {
+		buf.WriteString(c.Title)
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(c.URL)
+	buf.WriteByte('\n')
+	if s := pinboard.TagList(c.Tags).String(); s != "" {
+		buf.WriteString(s)
+		buf.WriteByte('\n')
+	}
+	if s := pinboard.FormatFlags(c.Private, c.ToRead); s != "" {
+		buf.WriteString(s)
+		buf.WriteByte('\n')
+	}
+	if c.Source != SourcePinboard {
+		buf.WriteString("via ")
+		buf.WriteString(c.Source)
+		buf.WriteByte('\n')
+	}
+	if c.Description != "" {
+		buf.WriteByte('\n')
+		buf.WriteString(strings.TrimSpace(c.Description))
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+func (c *Candidate) PinboardPost() *pinboard.Post {
+	return &pinboard.Post{
+		URL:         c.URL,
+		Title:       c.Title,
+		Time:        c.Time,
+		Tags:        pinboard.TagList(c.Tags),
+		Description: c.Description,
+		Private:     c.Private,
+		ToRead:      c.ToRead,
+	}
+}
+
+// Source provides candidates. Each source decides on its own which of its
+// items are meant for publishing; the rest are not returned.
+type Source interface {
+	Name() string
+	LoadCandidates() ([]*Candidate, error)
+}
+
+const (
+	SourcePinboard    = "pinboard"
+	SourceSubmissions = "bot"
+	SourceInbox       = "inbox"
+	SourceImport      = "import"
+	SourceFeed        = "feed"
+)
+
+// SourceOptions configure the sources used in addition to Pinboard and the
+// links submitted to the bot.
+type SourceOptions struct {
+	// InboxDir holds .md and .json files with candidates, see inboxSource.
+	InboxDir string
+	Feeds    []FeedOptions
+	// ImportFiles are bookmark exports, see pinboard.ParseExport.
+	ImportFiles []string
+	// PinboardFile is an export read instead of calling Pinboard for the
+	// recent bookmarks, for testing.
+	PinboardFile string
+	Transport    http.RoundTripper
+}
+
+type FeedOptions struct {
+	URL string
+	// MarkerTag limits the feed to items in this category; empty means
+	// that every item is a candidate (like in a feed of starred items).
+	MarkerTag string
+}
+
+func (env *Env) sources() []Source {
+	conf := env.Conf
+	var sources []Source
+	if conf.Sources.PinboardFile != "" {
+		sources = append(sources, &importSource{conf.Sources.PinboardFile, SourcePinboard, conf.Content.MarkerTag})
+	} else {
+		sources = append(sources, &pinboardSource{env.Pinboard, conf.Content.MarkerTag})
+	}
+	sources = append(sources, &submissionSource{env.State})
+	if conf.Sources.InboxDir != "" {
+		sources = append(sources, &inboxSource{conf.Sources.InboxDir, conf.Content.MarkerTag})
+	}
+	feedClient := &http.Client{
+		Transport: conf.Sources.Transport,
+		Timeout:   10 * time.Second,
+	}
+	for _, fo := range conf.Sources.Feeds {
+		sources = append(sources, &feedSource{fo, conf.Content.MarkerTag, feedClient})
+	}
+	for _, fn := range conf.Sources.ImportFiles {
+		sources = append(sources, &importSource{fn, SourceImport, conf.Content.MarkerTag})
+	}
+	return sources
+}
+
+// loadCandidates merges the candidates from all sources in order, keeping
+// the first one of those sharing a canonical URL. The first source is
+// Pinboard, which must not fail; any other one that does is skipped, so that
+// e.g. a feed being down doesn't hold up the rest.
+func loadCandidates(sources []Source) ([]*Candidate, error) {
+	var result []*Candidate
+	seen := make(map[string]string)
+	for i, src := range sources {
+		cands, err := src.LoadCandidates()
+		if err != nil && i == 0 {
+			return nil, fmt.Errorf("%s: %w", src.Name(), err)
+		} else if err != nil {
+			log.Printf("WARNING: skipping %s: %v", src.Name(), err)
+			continue
+		}
+		for _, c := range cands {
+			canon := CanonicalURL(c.URL)
+			if prev, found := seen[canon]; found {
+				if prev != c.Source {
+					log.Printf("DUPLICATE: %s from %s is already in %s", c.URL, c.Source, prev)
+				}
+				continue
+			}
+			seen[canon] = c.Source
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+// pinboardSource returns the recent bookmarks having the marker tag.
+type pinboardSource struct {
+	client    *pinboard.Client
+	markerTag string
+}
+
+func (src *pinboardSource) Name() string {
+	return SourcePinboard
+}
+
+func (src *pinboardSource) LoadCandidates() ([]*Candidate, error) {
+	posts, err := src.client.Recent(pinboard.RecentRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return pinboardCandidates(posts, SourcePinboard, src.markerTag), nil
+}
+
+func pinboardCandidates(posts []*pinboard.Post, source, markerTag string) []*Candidate {
+	var result []*Candidate
+	for _, post := range posts {
+		if markerTag != "" && !post.Tags.Contains(markerTag) {
+			log.Println()
+			log.Printf("IGNORING: %s", post.TitleOrURL())
+			continue
+		}
+		result = append(result, pinboardCandidate(post, source))
+	}
+	return result
+}
+
+func pinboardCandidate(post *pinboard.Post, source string) *Candidate {
+	return &Candidate{
+		Source:      source,
+		URL:         post.URL,
+		Title:       post.Title,
+		Time:        post.Time,
+		Tags:        []string(post.Tags),
+		Description: post.Description,
+		Private:     post.Private,
+		ToRead:      post.ToRead,
+	}
+}
+
+// importSource reads a Pinboard or browser bookmark export, e.g. to backfill
+// the archive. Like with Pinboard, only bookmarks with the marker tag count.
+type importSource struct {
+	file      string
+	source    string
+	markerTag string
+}
+
+func (src *importSource) Name() string {
+	return src.source + " " + src.file
+}
+
+func (src *importSource) LoadCandidates() ([]*Candidate, error) {
+	raw, err := ioutil.ReadFile(src.file)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := pinboard.ParseExport(raw)
+	if err != nil {
+		return nil, err
+	}
+	return pinboardCandidates(posts, src.source, src.markerTag), nil
+}
+
+// submissionSource returns the links sent to the bot, which already got
+// the marker tag when submitted.
+type submissionSource struct {
+	state *State
+}
+
+func (src *submissionSource) Name() string {
+	return SourceSubmissions
+}
+
+func (src *submissionSource) LoadCandidates() ([]*Candidate, error) {
+	var result []*Candidate
+	for _, sub := range src.state.Submissions {
+		result = append(result, sub.Candidate())
+	}
+	return result, nil
+}
+
+// inboxSource reads candidates from a local directory. Being in the inbox
+// is what marks a link for publishing, so every item is a candidate and
+// gets the marker tag.
+//
+// A .md file holds a single candidate: an optional "# Title" line, then
+// the link, comment, #hashtags and trailing links like in a message sent
+// to the bot. A .json file holds a candidate object or an array of them.
+type inboxSource struct {
+	dir       string
+	markerTag string
+}
+
+type inboxItem struct {
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	Time        time.Time `json:"time"`
+	Tags        []string  `json:"tags"`
+	Description string    `json:"description"`
+}
+
+func (src *inboxSource) Name() string {
+	return SourceInbox
+}
+
+func (src *inboxSource) LoadCandidates() ([]*Candidate, error) {
+	files, err := ioutil.ReadDir(src.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Candidate
+	for _, fi := range files {
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		fn := filepath.Join(src.dir, fi.Name())
+
+		var cands []*Candidate
+		switch strings.ToLower(filepath.Ext(fi.Name())) {
+		case ".md", ".markdown":
+			var c *Candidate
+			c, err = src.loadMarkdown(fn, fi.ModTime())
+			cands = []*Candidate{c}
+		case ".json":
+			cands, err = src.loadJSON(fn, fi.ModTime())
+		default:
+			continue
+		}
+		if err != nil {
+			log.Printf("WARNING: skipping %s: %v", fn, err)
+			continue
+		}
+		result = append(result, cands...)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Time.After(result[j].Time)
+	})
+	return result, nil
+}
+
+func (src *inboxSource) loadMarkdown(fn string, modTime time.Time) (*Candidate, error) {
+	raw, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	return parseInboxMarkdown(string(raw), src.markerTag, modTime)
+}
+
+func parseInboxMarkdown(text string, markerTag string, modTime time.Time) (*Candidate, error) {
+	var title string
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "# ") {
+		title = text[2:]
+		text = ""
+		if i := strings.IndexByte(title, '\n'); i >= 0 {
+			title, text = title[:i], title[i+1:]
+		}
+		title = strings.TrimSpace(title)
+	}
+
+	sub, err := parseSubmission(text, markerTag, modTime)
+	if err != nil {
+		return nil, err
+	}
+	sub.Title = title
+
+	c := sub.Candidate()
+	c.Source = SourceInbox
+	return c, nil
+}
+
+func (src *inboxSource) loadJSON(fn string, modTime time.Time) ([]*Candidate, error) {
+	raw, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*inboxItem
+	if trimmed := strings.TrimSpace(string(raw)); strings.HasPrefix(trimmed, "[") {
+		err = json.Unmarshal(raw, &items)
+	} else {
+		var item inboxItem
+		err = json.Unmarshal(raw, &item)
+		items = []*inboxItem{&item}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Candidate
+	for i, item := range items {
+		if item.URL == "" {
+			return nil, fmt.Errorf("item %d has no url", i)
+		}
+		c := &Candidate{
+			Source:      SourceInbox,
+			URL:         item.URL,
+			Title:       item.Title,
+			Time:        item.Time,
+			Tags:        addTag(item.Tags, src.markerTag),
+			Description: item.Description,
+		}
+		if c.Time.IsZero() {
+			c.Time = modTime
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// feedSource reads candidates from an RSS or Atom feed. Item categories
+// become tags; see FeedOptions.MarkerTag for which items are candidates.
+type feedSource struct {
+	opt       FeedOptions
+	markerTag string
+	client    *http.Client
+}
+
+func (src *feedSource) Name() string {
+	return SourceFeed + " " + src.opt.URL
+}
+
+func (src *feedSource) LoadCandidates() ([]*Candidate, error) {
+	items, err := feed.Load(src.opt.URL, src.client)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Candidate
+	for _, item := range items {
+		if !isWebURL(item.URL) {
+			if item.URL != "" {
+				log.Printf("WARNING: skipping %s from %s: not an http(s) link", item.URL, src.opt.URL)
+			}
+			continue
+		}
+		var tags []string
+		for _, cat := range item.Categories {
+			tags = append(tags, strings.ReplaceAll(strings.TrimSpace(cat), " ", "-"))
+		}
+		if src.opt.MarkerTag != "" && !containsTag(tags, src.opt.MarkerTag) {
+			continue
+		}
+		result = append(result, &Candidate{
+			Source:      SourceFeed,
+			URL:         item.URL,
+			Title:       item.Title,
+			Time:        item.Time,
+			Tags:        addTag(tags, src.markerTag),
+			Description: item.Description,
+		})
+	}
+	return result, nil
+}
+
+func addTag(tags []string, tag string) []string {
+	if tag == "" || containsTag(tags, tag) {
+		return tags
+	}
+	return append(tags, tag)
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func isWebURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
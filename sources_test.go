@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type staticSource []*Candidate
+
+func (src staticSource) Name() string {
+	return "static"
+}
+
+func (src staticSource) LoadCandidates() ([]*Candidate, error) {
+	return src, nil
+}
+
+type failingSource struct{}
+
+func (src failingSource) Name() string {
+	return "failing"
+}
+
+func (src failingSource) LoadCandidates() ([]*Candidate, error) {
+	return nil, errors.New("feed is down")
+}
+
+func TestLoadCandidates(t *testing.T) {
+	a := &Candidate{Source: SourcePinboard, URL: "https://example.com/a"}
+	b := &Candidate{Source: SourcePinboard, URL: "https://example.com/b"}
+	a2 := &Candidate{Source: SourceFeed, URL: "http://Example.com/a"}
+	c := &Candidate{Source: SourceFeed, URL: "https://example.com/c"}
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	actual, err := loadCandidates([]Source{staticSource{a, b}, failingSource{}, staticSource{a2, c}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*Candidate{a, b, c}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("loadCandidates = %v, wanted %v", actual, expected)
+	}
+
+	if _, err := loadCandidates([]Source{failingSource{}, staticSource{a2, c}}); err == nil {
+		t.Errorf("loadCandidates succeeded without Pinboard, wanted an error")
+	}
+}
+
+func TestInboxSourceSkipsMalformedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "good.md"), []byte("https://example.com/good\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "bad.json"), []byte(`{"url": `), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "nolink.md"), []byte("just a comment\n"), 0644)
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	cands, err := (&inboxSource{dir, "ytn"}).LoadCandidates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cands) != 1 || cands[0].URL != "https://example.com/good" {
+		t.Errorf("LoadCandidates = %v, wanted only the good file", cands)
+	}
+}
+
+func TestFeedSourceWebLinksOnly(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Starred</title>
+<item><title>Good</title><link>https://example.com/good</link></item>
+<item><title>Script</title><link>javascript:alert(1)</link></item>
+<item><title>Local</title><link>file:///etc/passwd</link></item>
+</channel></rss>`))
+	}))
+	defer srv.Close()
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	cands, err := (&feedSource{FeedOptions{URL: srv.URL}, "ytn", srv.Client()}).LoadCandidates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cands) != 1 || cands[0].URL != "https://example.com/good" {
+		t.Errorf("LoadCandidates = %v, wanted only the http(s) item", cands)
+	}
+}
+
+func TestParseInboxMarkdown(t *testing.T) {
+	mtime := time.Date(2020, 11, 9, 16, 0, 0, 0, time.UTC)
+	input := "# An Article\n\nhttps://example.com/article\nWorth reading.\n\n#tools"
+	expected := &Candidate{
+		Source:      SourceInbox,
+		URL:         "https://example.com/article",
+		Title:       "An Article",
+		Time:        mtime,
+		Tags:        []string{"ytn", "tools"},
+		Description: "Worth reading.",
+	}
+	actual, err := parseInboxMarkdown(input, "ytn", mtime)
+	if err != nil {
+		t.Fatalf("parseInboxMarkdown(%q) failed: %v", input, err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("parseInboxMarkdown(%q) = %+v, wanted %+v", input, actual, expected)
+	}
+}
@@ -10,11 +10,13 @@ import (
 )
 
 const (
+	// ChannelTelegram is the state key of the primary Telegram channel.
 	ChannelTelegram = "tg"
 )
 
 type State struct {
 	PublishedArticles map[string]*ArticleState `json:"published_articles"`
+	Submissions       []*Submission            `json:"submissions,omitempty"`
 }
 
 func (state *State) LookupArticle(url string) *ArticleState {
@@ -36,12 +38,31 @@ type ArticleState struct {
 	URL      string                          `json:"url"`
 	Skip     bool                            `json:"skip,omitempty"`
 	Channels map[string]*ArticleChannelState `json:"ch"`
+	// Partial records the destinations where a long post split into
+	// several messages has only been partially sent.
+	Partial map[string]*PartialPublish `json:"partial,omitempty"`
+}
+
+func (as *ArticleState) IsPublishedToAll(dests []*Destination) bool {
+	for _, dest := range dests {
+		if as.Channels[dest.Key] == nil {
+			return false
+		}
+	}
+	return true
 }
 
 type ArticleChannelState struct {
 	PublishTime time.Time `json:"t"`
 }
 
+// PartialPublish lets a failed publish resume after the messages already sent.
+type PartialPublish struct {
+	Sent    int `json:"sent"`
+	ReplyTo int `json:"reply_to,omitempty"`
+	PinID   int `json:"pin_id,omitempty"`
+}
+
 func ReadState(fn string) (*State, error) {
 	raw, err := ioutil.ReadFile(fn)
 	if err != nil {
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/pinboard"
+)
+
+// StatusTagOptions name the tags added to Pinboard bookmarks once they have
+// been published or permanently skipped, so that the state can be rebuilt
+// from Pinboard. Empty names turn the write-back off.
+type StatusTagOptions struct {
+	Published string
+	Skipped   string
+}
+
+func (opt StatusTagOptions) Tags() []string {
+	var tags []string
+	for _, tag := range []string{opt.Published, opt.Skipped} {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// tagBookmark adds the status tag to the candidate's Pinboard bookmark.
+// Failures are only logged: the state file has the decision already.
+func (env *Env) tagBookmark(c *Candidate, tag string) {
+	if tag == "" || c.Source != SourcePinboard {
+		return
+	}
+	if env.Conf.Telegram.DryMode {
+		log.Printf("[pinboard] dry run, not tagging %s with %s", c.URL, tag)
+		return
+	}
+	if err := addBookmarkTag(env.Pinboard, c.URL, tag); err != nil {
+		log.Printf("[pinboard] WARNING: cannot tag %s with %s: %v", c.URL, tag, err)
+	}
+}
+
+func addBookmarkTag(client *pinboard.Client, url, tag string) error {
+	return updateBookmark(client, url, func(post *pinboard.Post) bool {
+		if post.Tags.Contains(tag) {
+			return false
+		}
+		post.Tags = append(post.Tags, tag)
+		return true
+	})
+}
+
+// updateBookmark re-saves the current version of the bookmark if update
+// changes it, keeping the fields it doesn't touch.
+func updateBookmark(client *pinboard.Client, url string, update func(post *pinboard.Post) bool) error {
+	post, err := client.Lookup(url)
+	if err != nil {
+		return err
+	}
+	if post == nil {
+		return fmt.Errorf("bookmark not found")
+	}
+	if !update(post) {
+		return nil
+	}
+	return client.Add(post, true)
+}
+
+// RebuildState adds the bookmarks having the status tags to the state file,
+// keeping the records it already has. Published bookmarks are recorded as
+// published to every destination accepting their category, at the time
+// they were bookmarked.
+func RebuildState(conf Configuration) error {
+	if conf.StatusTags.Published == "" && conf.StatusTags.Skipped == "" {
+		return fmt.Errorf("no status tags configured")
+	}
+	env, err := newEnv(conf)
+	if err != nil {
+		return err
+	}
+	return env.rebuildState()
+}
+
+func (env *Env) rebuildState() error {
+	var published, skipped int
+	if tag := env.Conf.StatusTags.Published; tag != "" {
+		posts, err := env.Pinboard.All(pinboard.AllRequest{Tags: []string{tag}})
+		if err != nil {
+			return err
+		}
+		for _, pp := range posts {
+			if env.recordPublished(pp) {
+				published++
+			}
+		}
+	}
+	if tag := env.Conf.StatusTags.Skipped; tag != "" {
+		posts, err := env.Pinboard.All(pinboard.AllRequest{Tags: []string{tag}})
+		if err != nil {
+			return err
+		}
+		for _, pp := range posts {
+			as := env.State.LookupArticle(pp.URL)
+			if !as.Skip {
+				as.Skip = true
+				skipped++
+			}
+		}
+	}
+
+	log.Printf("Recorded %d published and %d skipped bookmarks.", published, skipped)
+	return env.saveState()
+}
+
+func (env *Env) recordPublished(pp *pinboard.Post) bool {
+	post, err := parsePost(pinboardCandidate(pp, SourcePinboard), env.Conf.Content)
+	if err != nil {
+		log.Printf("WARNING: %s: %v", pp.URL, err)
+		return false
+	}
+
+	as := env.State.LookupArticle(pp.URL)
+	changed := false
+	for _, dest := range env.Conf.Destinations {
+		if !dest.Accepts(post.Category) || as.Channels[dest.Key] != nil {
+			continue
+		}
+		as.Channels[dest.Key] = &ArticleChannelState{
+			PublishTime: pp.Time,
+		}
+		changed = true
+	}
+	if changed {
+		log.Printf("PUBLISHED: %s", pp.URL)
+	}
+	return changed
+}
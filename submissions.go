@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Submission is a candidate post sent to the bot as a link.
+type Submission struct {
+	URL         string    `json:"url"`
+	Title       string    `json:"title,omitempty"`
+	Time        time.Time `json:"t"`
+	Tags        []string  `json:"tags,omitempty"`
+	Description string    `json:"desc,omitempty"`
+}
+
+func (sub *Submission) Candidate() *Candidate {
+	return &Candidate{
+		Source:      SourceSubmissions,
+		URL:         sub.URL,
+		Title:       sub.Title,
+		Time:        sub.Time,
+		Tags:        sub.Tags,
+		Description: sub.Description,
+	}
+}
+
+func (state *State) LookupSubmission(url string) *Submission {
+	canon := CanonicalURL(url)
+	for _, sub := range state.Submissions {
+		if CanonicalURL(sub.URL) == canon {
+			return sub
+		}
+	}
+	return nil
+}
+
+// RemoveSubmission forgets the submission once it has been decided on,
+// as the article state tells the rest.
+func (state *State) RemoveSubmission(url string) bool {
+	canon := CanonicalURL(url)
+	for i, sub := range state.Submissions {
+		if CanonicalURL(sub.URL) == canon {
+			state.Submissions = append(state.Submissions[:i], state.Submissions[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+var submissionURLRe = regexp.MustCompile(`https?://\S+`)
+
+// parseSubmission parses a message sent to the bot: a link on its own line
+// (or anywhere in the text), optionally followed by a comment, lines of
+// hashtags and trailing links like in a Pinboard description.
+func parseSubmission(text string, markerTag string, now time.Time) (*Submission, error) {
+	sub := &Submission{
+		Time: now,
+	}
+	if markerTag != "" {
+		sub.Tags = append(sub.Tags, markerTag)
+	}
+
+	var descLines []string
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if sub.URL == "" && trimmed != "" && submissionURLRe.FindString(trimmed) == trimmed {
+			sub.URL = trimmed
+			continue
+		}
+		if tags, ok := parseHashtagLine(trimmed); ok {
+			for _, tag := range tags {
+				if !containsTag(sub.Tags, tag) {
+					sub.Tags = append(sub.Tags, tag)
+				}
+			}
+			continue
+		}
+		descLines = append(descLines, line)
+	}
+	sub.Description = strings.TrimSpace(strings.Join(descLines, "\n"))
+
+	if sub.URL == "" {
+		sub.URL = strings.TrimRight(submissionURLRe.FindString(sub.Description), ".,;:!?)")
+	}
+	if sub.URL == "" {
+		return nil, fmt.Errorf("no link found")
+	}
+	return sub, nil
+}
+
+func parseHashtagLine(line string) ([]string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil, false
+	}
+	tags := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if len(f) < 2 || f[0] != '#' {
+			return nil, false
+		}
+		tags = append(tags, f[1:])
+	}
+	return tags, true
+}
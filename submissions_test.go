@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSubmission(t *testing.T) {
+	now := time.Date(2020, 11, 9, 16, 0, 0, 0, time.UTC)
+	tests := []struct {
+		Input    string
+		Expected *Submission
+	}{
+		{
+			"https://example.com/article",
+			&Submission{URL: "https://example.com/article", Tags: []string{"ytn"}},
+		},
+		{
+			"https://example.com/article\nGreat read about things.\n\n#security #tools\nhttps://news.ycombinator.com/item?id=123",
+			&Submission{URL: "https://example.com/article", Tags: []string{"ytn", "security", "tools"}, Description: "Great read about things.\n\nhttps://news.ycombinator.com/item?id=123"},
+		},
+		{
+			"Look at https://example.com/x, it's neat\n#fun",
+			&Submission{URL: "https://example.com/x", Tags: []string{"ytn", "fun"}, Description: "Look at https://example.com/x, it's neat"},
+		},
+	}
+	for _, test := range tests {
+		test.Expected.Time = now
+		actual, err := parseSubmission(test.Input, "ytn", now)
+		if err != nil {
+			t.Errorf("parseSubmission(%q) failed: %v", test.Input, err)
+		} else if !reflect.DeepEqual(actual, test.Expected) {
+			t.Errorf("parseSubmission(%q) = %+v, wanted %+v", test.Input, actual, test.Expected)
+		}
+	}
+
+	if _, err := parseSubmission("no links here\n#fun", "ytn", now); err == nil {
+		t.Errorf("parseSubmission without a link succeeded, wanted an error")
+	}
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/telegram"
+)
+
+// quotes longer than this are rendered collapsed in HTML mode
+const expandableQuoteLength = 300
+
+type telegramFormatter interface {
+	ParseMode() telegram.ParseMode
+	// Escape escapes plain text so that it is rendered verbatim.
+	Escape(s string) string
+	// EscapeDescription escapes description text, keeping *bold* and `code` spans.
+	EscapeDescription(s string) string
+	Bold(text string) string
+	Link(text, url string) string
+	// FormatBlocks handles line-level formatting of the assembled description.
+	FormatBlocks(desc string) string
+}
+
+func formatterFor(mode telegram.ParseMode) telegramFormatter {
+	if mode == telegram.ParseModeHTML {
+		return htmlFormatter{}
+	}
+	return markdownFormatter{}
+}
+
+type markdownFormatter struct{}
+
+func (markdownFormatter) ParseMode() telegram.ParseMode {
+	return telegram.ParseModeMarkdownV2
+}
+
+func (markdownFormatter) Escape(s string) string {
+	return telegram.Escape(s)
+}
+
+func (markdownFormatter) EscapeDescription(s string) string {
+	return telegram.EscapeExceptFormatting(s)
+}
+
+func (markdownFormatter) Bold(text string) string {
+	return fmt.Sprintf("*%s*", text)
+}
+
+func (markdownFormatter) Link(text, url string) string {
+	return fmt.Sprintf("[%s](%s)", text, telegram.Escape(url))
+}
+
+func (markdownFormatter) FormatBlocks(desc string) string {
+	return desc
+}
+
+type htmlFormatter struct{}
+
+func (htmlFormatter) ParseMode() telegram.ParseMode {
+	return telegram.ParseModeHTML
+}
+
+func (htmlFormatter) Escape(s string) string {
+	return telegram.EscapeHTML(s)
+}
+
+func (htmlFormatter) EscapeDescription(s string) string {
+	return formatInlineHTML(s)
+}
+
+func (htmlFormatter) Bold(text string) string {
+	return "<b>" + text + "</b>"
+}
+
+func (htmlFormatter) Link(text, url string) string {
+	return fmt.Sprintf(`<a href="%s">%s</a>`, telegram.EscapeHTML(url), text)
+}
+
+func (htmlFormatter) FormatBlocks(desc string) string {
+	const quotePrefix = "&gt;"
+
+	lines := splitLines(desc)
+	var result []string
+	var quote []string
+	flush := func() {
+		if len(quote) == 0 {
+			return
+		}
+		text := strings.Join(quote, "\n")
+		if len(text) > expandableQuoteLength {
+			result = append(result, "<blockquote expandable>"+text+"</blockquote>")
+		} else {
+			result = append(result, "<blockquote>"+text+"</blockquote>")
+		}
+		quote = nil
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, quotePrefix) {
+			quote = append(quote, strings.TrimPrefix(strings.TrimPrefix(line, quotePrefix), " "))
+		} else {
+			flush()
+			result = append(result, line)
+		}
+	}
+	flush()
+	return strings.Join(result, "\n")
+}
+
+// formatInlineHTML escapes s for Telegram HTML, turning paired *bold* and
+// `code` spans into tags. Unpaired markers are kept as literal characters.
+func formatInlineHTML(s string) string {
+	var buf strings.Builder
+	for s != "" {
+		i := strings.IndexAny(s, "*`")
+		if i < 0 {
+			buf.WriteString(telegram.EscapeHTML(s))
+			break
+		}
+		buf.WriteString(telegram.EscapeHTML(s[:i]))
+
+		c, rest := s[i], s[i+1:]
+		j := strings.IndexByte(rest, c)
+		if j <= 0 || strings.Contains(rest[:j], "\n") {
+			buf.WriteByte(c)
+			s = rest
+			continue
+		}
+
+		inner := rest[:j]
+		if c == '`' {
+			buf.WriteString("<code>" + telegram.EscapeHTML(inner) + "</code>")
+		} else {
+			buf.WriteString("<b>" + formatInlineHTML(inner) + "</b>")
+		}
+		s = rest[j+1:]
+	}
+	return buf.String()
+}
+
+const ellipsis = "…"
+
+// telegramText is a post rendered into the pieces that a message is
+// assembled from, so that the description can be cut to fit the limit.
+type telegramText struct {
+	f          telegramFormatter
+	header     string
+	paragraphs [][]*Region
+	trailer    string
+}
+
+func newTelegramText(p *Post, f telegramFormatter) *telegramText {
+	t := &telegramText{f: f}
+
+	var buf strings.Builder
+	// buf.WriteString(telegram.EscapeReserved(telegram.EscapeForMarkdown(time.Now().Format(time.RFC3339))) + "\n")
+	if p.TitleIsLink && p.Title != "" {
+		buf.WriteString(f.Bold(f.Link(f.Escape(p.Title), p.URL)))
+		buf.WriteByte('\n')
+	} else {
+		if p.Title != "" {
+			buf.WriteString(f.Bold(f.Escape(p.Title)))
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(f.Link(f.Escape(prettifyURL(p.URL)), p.URL))
+		buf.WriteByte('\n')
+	}
+	t.header = buf.String()
+
+	t.paragraphs = splitParagraphs(p.Description)
+
+	var tags []string
+	if p.Category != nil {
+		tags = append(tags, p.Category.PreferredTag())
+	}
+	tags = append(tags, p.Tags...)
+
+	var trailers []string
+	for _, link := range p.StickyLinks {
+		trailers = append(trailers, f.Link(f.Escape(link.text()), link.URL))
+	}
+	if len(tags) > 0 {
+		trailers = append(trailers, f.Escape(buildTags(tags)))
+	}
+	t.trailer = strings.Join(trailers, " · ")
+
+	return t
+}
+
+func (t *telegramText) String() string {
+	return t.render(true, t.paragraphs, false, true)
+}
+
+func (t *telegramText) render(header bool, paragraphs [][]*Region, truncated, trailer bool) string {
+	var buf strings.Builder
+	if header {
+		buf.WriteString(t.header)
+	}
+
+	formatted := make([]string, 0, len(paragraphs))
+	for _, para := range paragraphs {
+		formatted = append(formatted, t.formatParagraph(para))
+	}
+	desc := strings.Join(formatted, "\n\n")
+	if truncated {
+		desc = strings.TrimRightFunc(desc, unicode.IsSpace) + ellipsis
+	}
+
+	// TODO: format explicit links
+
+	isMultiParagraph := strings.Contains(desc, "\n\n")
+	if fragment := t.trailer; trailer && fragment != "" {
+		last := lastLine(splitLines(desc))
+		if isMultiParagraph || isSpecialLine(last) || t.f.ParseMode() == telegram.ParseModeHTML && strings.HasSuffix(last, "</blockquote>") {
+			desc = desc + "\n\n" + fragment
+		} else if desc != "" {
+			desc = desc + "\n" + fragment
+		} else {
+			desc = fragment
+		}
+	}
+
+	if d := strings.TrimSpace(desc); d != "" {
+		if header {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(d)
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+func (t *telegramText) formatParagraph(regions []*Region) string {
+	var buf strings.Builder
+	for _, r := range regions {
+		if r.PrimaryOccurrance && r.LinkValue != "" {
+			buf.WriteString(t.f.Link(t.f.EscapeDescription(r.Text), r.LinkValue))
+		} else {
+			buf.WriteString(t.f.EscapeDescription(r.Text))
+		}
+	}
+	return t.f.FormatBlocks(buf.String())
+}
+
+func (t *telegramText) fits(text string, limit int) bool {
+	return telegram.TextLength(text, t.f.ParseMode()) <= limit
+}
+
+// Truncate returns the text cut down to the given limit by dropping trailing
+// description paragraphs (or, failing that, words), keeping the header and
+// the trailing sticky links and tags.
+func (t *telegramText) Truncate(limit int) string {
+	full := t.String()
+	if t.fits(full, limit) {
+		return full
+	}
+
+	for n := len(t.paragraphs) - 1; n >= 1; n-- {
+		if s := t.render(true, t.paragraphs[:n], true, true); t.fits(s, limit) {
+			return s
+		}
+	}
+
+	if len(t.paragraphs) == 0 {
+		return full
+	}
+	first := t.paragraphs[0]
+	k := t.maxCut(first, limit, func(head []*Region) string {
+		return t.render(true, [][]*Region{head}, true, true)
+	})
+	head, _ := cutRegions(first, k)
+	return t.render(true, [][]*Region{head}, true, true)
+}
+
+// Split returns the text broken into several messages at paragraph boundaries
+// (or word boundaries for paragraphs that don't fit on their own), each
+// within the given limit. Only the first message has the header, and only
+// the last one has the trailer.
+func (t *telegramText) Split(limit int) []string {
+	full := t.String()
+	if t.fits(full, limit) {
+		return []string{full}
+	}
+
+	var result []string
+	header := true
+	var cur [][]*Region
+	remaining := append([][]*Region(nil), t.paragraphs...)
+	for len(remaining) > 0 {
+		para := remaining[0]
+		candidate := append(append([][]*Region(nil), cur...), para)
+		if t.fits(t.render(header, candidate, false, false), limit) {
+			cur = candidate
+			remaining = remaining[1:]
+			continue
+		}
+		if len(cur) > 0 {
+			result = append(result, t.render(header, cur, false, false))
+			header, cur = false, nil
+			continue
+		}
+
+		k := t.maxCut(para, limit, func(head []*Region) string {
+			return t.render(header, [][]*Region{head}, false, false)
+		})
+		if k == 0 {
+			// not even a single word fits, cut wherever
+			k = limit / 2
+		}
+		head, tail := cutRegions(para, k)
+		result = append(result, t.render(header, [][]*Region{head}, false, false))
+		header = false
+		remaining[0] = tail
+		if len(tail) == 0 {
+			remaining = remaining[1:]
+		}
+	}
+
+	if last := t.render(header, cur, false, true); t.fits(last, limit) || len(cur) == 0 {
+		result = append(result, last)
+	} else {
+		result = append(result, t.render(header, cur, false, false), t.render(false, nil, false, true))
+	}
+	return result
+}
+
+// maxCut finds the longest prefix of the paragraph (in bytes of source text)
+// for which the text produced by render still fits.
+func (t *telegramText) maxCut(regions []*Region, limit int, render func(head []*Region) string) int {
+	total := regionsLen(regions)
+	n := sort.Search(total+1, func(k int) bool {
+		head, _ := cutRegions(regions, k)
+		return !t.fits(render(head), limit)
+	})
+	if n == 0 {
+		return 0
+	}
+	return n - 1
+}
+
+func splitParagraphs(regions []*Region) [][]*Region {
+	var result [][]*Region
+	var cur []*Region
+	for _, r := range regions {
+		pieces := strings.Split(r.Text, "\n\n")
+		for i, piece := range pieces {
+			if i > 0 {
+				result = append(result, cur)
+				cur = nil
+			}
+			if piece != "" {
+				rr := *r
+				rr.Text = piece
+				cur = append(cur, &rr)
+			}
+		}
+	}
+	if len(cur) > 0 {
+		result = append(result, cur)
+	}
+	return result
+}
+
+func regionsLen(regions []*Region) int {
+	n := 0
+	for _, r := range regions {
+		n += len(r.Text)
+	}
+	return n
+}
+
+// cutRegions splits the regions at the last whitespace within the first
+// k bytes of their text.
+func cutRegions(regions []*Region, k int) (head, tail []*Region) {
+	var text strings.Builder
+	for _, r := range regions {
+		text.WriteString(r.Text)
+	}
+	s := text.String()
+	if k >= len(s) {
+		return regions, nil
+	}
+
+	cut := strings.LastIndexFunc(s[:k+1], unicode.IsSpace)
+	if cut < 0 {
+		cut = k
+		for cut > 0 && !utf8RuneStart(s[cut]) {
+			cut--
+		}
+	}
+
+	off := 0
+	for _, r := range regions {
+		end := off + len(r.Text)
+		switch {
+		case end <= cut:
+			head = append(head, r)
+		case off >= cut:
+			tail = append(tail, r)
+		default:
+			h, tl := *r, *r
+			h.Text = r.Text[:cut-off]
+			tl.Text = r.Text[cut-off:]
+			head = append(head, &h)
+			tail = append(tail, &tl)
+		}
+		off = end
+	}
+
+	if len(tail) > 0 {
+		first := *tail[0]
+		first.Text = strings.TrimLeftFunc(first.Text, unicode.IsSpace)
+		if first.Text == "" {
+			tail = tail[1:]
+		} else {
+			tail[0] = &first
+		}
+	}
+
+	// close the *bold* and `code` spans cut in two, and reopen them in the
+	// tail, or Telegram rejects an unmatched MarkdownV2 entity
+	if open := openSpans(s, cut); len(open) > 0 && len(head) > 0 {
+		last := *head[len(head)-1]
+		for i := len(open) - 1; i >= 0; i-- {
+			last.Text += string(open[i])
+		}
+		head[len(head)-1] = &last
+		if len(tail) > 0 {
+			first := *tail[0]
+			first.Text = string(open) + first.Text
+			tail[0] = &first
+		}
+	}
+	return head, tail
+}
+
+// openSpans returns the markers of the *bold* and `code` spans that
+// contain position cut, outermost first, paired like formatInlineHTML does.
+func openSpans(s string, cut int) []byte {
+	var result []byte
+	off := 0
+	for s != "" {
+		i := strings.IndexAny(s, "*`")
+		if i < 0 || off+i >= cut {
+			break
+		}
+		c, rest := s[i], s[i+1:]
+		j := strings.IndexByte(rest, c)
+		if j <= 0 || strings.Contains(rest[:j], "\n") {
+			s, off = rest, off+i+1
+			continue
+		}
+		end := off + i + 1 + j
+		if cut > end {
+			s, off = rest[j+1:], end+1
+			continue
+		}
+		result = append(result, c)
+		if c == '`' {
+			break
+		}
+		s, off = rest[:j], off+i+1
+	}
+	return result
+}
+
+func utf8RuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
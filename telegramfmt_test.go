@@ -0,0 +1,170 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andreyvit/yesterdaytechnewsbot/internal/telegram"
+)
+
+func TestFormatInlineHTML(t *testing.T) {
+	tests := []struct {
+		Input    string
+		Expected string
+	}{
+		{"Hello world", "Hello world"},
+		{"a < b && c > d", "a &lt; b &amp;&amp; c &gt; d"},
+		{"Hello *world*!", "Hello <b>world</b>!"},
+		{"Run `x < y` now", "Run <code>x &lt; y</code> now"},
+		{"*bold `code`*", "<b>bold <code>code</code></b>"},
+		{"2 * 3 = 6", "2 * 3 = 6"},
+		{"**", "**"},
+		{"*line\nbreak*", "*line\nbreak*"},
+	}
+	for _, test := range tests {
+		actual := formatInlineHTML(test.Input)
+		if actual != test.Expected {
+			t.Errorf("formatInlineHTML(%q) = %q, wanted %q", test.Input, actual, test.Expected)
+		}
+	}
+}
+
+func TestBuildTelegramHTML(t *testing.T) {
+	const header = `<b><a href="https://example.com/">Title</a></b>` + "\n\n"
+	long := strings.Repeat("quoted text ", 30)
+	tests := []struct {
+		Input    string
+		Expected string
+	}{
+		{"Hello *world* & co", header + "Hello <b>world</b> &amp; co\n#security\n"},
+		{"Intro:\n> first\n>second", header + "Intro:\n<blockquote>first\nsecond</blockquote>\n\n#security\n"},
+		{"> " + long, header + "<blockquote expandable>" + long + "</blockquote>\n\n#security\n"},
+	}
+	for _, test := range tests {
+		post := &Post{
+			URL:         "https://example.com/",
+			Title:       "Title",
+			TitleIsLink: true,
+			Tags:        []string{"security"},
+			Description: ParseExplicitLinks(test.Input, nil),
+		}
+		actual := buildTelegramHTML(post)
+		if actual != test.Expected {
+			t.Errorf("buildTelegramHTML(%q) = %q, wanted %q", test.Input, actual, test.Expected)
+		}
+	}
+}
+
+func TestBuildTelegramMarkdownLiteralBlockquote(t *testing.T) {
+	// only an HTML blockquote needs the tags on a separate paragraph
+	post := &Post{
+		URL:         "https://example.com/",
+		Title:       "Title",
+		TitleIsLink: true,
+		Tags:        []string{"security"},
+		Description: ParseExplicitLinks("Ends with </blockquote>", nil),
+	}
+	if actual, expected := buildTelegramMarkdown(post), "*[Title](https://example\\.com/)*\n\nEnds with </blockquote\\>\n\\#security\n"; actual != expected {
+		t.Errorf("buildTelegramMarkdown = %q, wanted %q", actual, expected)
+	}
+}
+
+func TestTelegramTextLimits(t *testing.T) {
+	para := strings.Repeat("word ", 20) // 100 chars
+	post := &Post{
+		URL:         "https://example.com/",
+		Title:       "Title",
+		Description: ParseExplicitLinks(strings.TrimSpace(strings.Repeat(para+"\n\n", 5)), nil),
+		StickyLinks: []Link{{Key: "HN", URL: "https://news.ycombinator.com/item?id=1"}},
+	}
+
+	for _, f := range []telegramFormatter{markdownFormatter{}, htmlFormatter{}} {
+		text := newTelegramText(post, f)
+		full := text.String()
+
+		if s := text.Truncate(1000); s != full {
+			t.Errorf("%s: Truncate(1000) = %q, wanted the full text %q", f.ParseMode(), s, full)
+		}
+
+		s := text.Truncate(300)
+		if n := telegram.TextLength(s, f.ParseMode()); n > 300 {
+			t.Errorf("%s: Truncate(300) has length %d", f.ParseMode(), n)
+		}
+		if !strings.Contains(s, "…\n\n") || !strings.HasSuffix(s, "HN</a>\n") && !strings.HasSuffix(s, "item?id\\=1)\n") {
+			t.Errorf("%s: Truncate(300) = %q, wanted an ellipsis followed by sticky links", f.ParseMode(), s)
+		}
+
+		s = text.Truncate(60)
+		if n := telegram.TextLength(s, f.ParseMode()); n > 60 || !strings.Contains(s, "word…") {
+			t.Errorf("%s: Truncate(60) = %q (length %d), wanted a word-level cut", f.ParseMode(), s, n)
+		}
+
+		parts := text.Split(300)
+		if len(parts) != 3 {
+			t.Errorf("%s: Split(300) returned %d parts, wanted 3: %q", f.ParseMode(), len(parts), parts)
+		}
+		for i, part := range parts {
+			if n := telegram.TextLength(part, f.ParseMode()); n > 300 {
+				t.Errorf("%s: Split(300) part %d has length %d", f.ParseMode(), i, n)
+			}
+			if hasTitle := strings.Contains(part, "Title"); hasTitle != (i == 0) {
+				t.Errorf("%s: Split(300) part %d = %q, wanted title only in the first part", f.ParseMode(), i, part)
+			}
+			if hasHN := strings.Contains(part, "HN"); hasHN != (i == len(parts)-1) {
+				t.Errorf("%s: Split(300) part %d = %q, wanted sticky links only in the last part", f.ParseMode(), i, part)
+			}
+		}
+		if got := strings.Count(strings.Join(parts, ""), "word"); got != 100 {
+			t.Errorf("%s: Split(300) kept %d words, wanted 100", f.ParseMode(), got)
+		}
+	}
+}
+
+func TestTelegramTextLongBoldSpan(t *testing.T) {
+	post := &Post{
+		URL:         "https://example.com/",
+		Title:       "Title",
+		TitleIsLink: true,
+		Description: ParseExplicitLinks("Intro *"+strings.TrimSpace(strings.Repeat("word ", 40))+"* outro", nil),
+	}
+
+	text := newTelegramText(post, markdownFormatter{})
+	parts := append([]string{text.Truncate(100)}, text.Split(120)...)
+	for _, part := range parts {
+		if n := strings.Count(part, "*"); n%2 != 0 {
+			t.Errorf("MarkdownV2: %q has %d asterisks, wanted all bold spans closed", part, n)
+		}
+	}
+	if s := parts[0]; !strings.Contains(s, "word*…") {
+		t.Errorf("MarkdownV2: Truncate(100) = %q, wanted the bold span closed before the ellipsis", s)
+	}
+
+	text = newTelegramText(post, htmlFormatter{})
+	for _, part := range text.Split(120) {
+		if strings.Count(part, "<b>") != strings.Count(part, "</b>") || !strings.Contains(part, "word</b>") {
+			t.Errorf("HTML: Split(120) part %q, wanted a bold span in each part", part)
+		}
+	}
+}
+
+func TestOpenSpans(t *testing.T) {
+	tests := []struct {
+		Input    string
+		Cut      int
+		Expected string
+	}{
+		{"plain text", 5, ""},
+		{"a *bold text* b", 7, "*"},
+		{"a *bold text* b", 13, ""},
+		{"a *bold text* b", 2, ""},
+		{"*bold `some code` here*", 11, "*`"},
+		{"2 * 3 = 6", 5, ""},
+		{"*a* *b c*", 6, "*"},
+	}
+	for _, test := range tests {
+		actual := string(openSpans(test.Input, test.Cut))
+		if actual != test.Expected {
+			t.Errorf("openSpans(%q, %d) = %q, wanted %q", test.Input, test.Cut, actual, test.Expected)
+		}
+	}
+}